@@ -0,0 +1,213 @@
+// Copyright (c) 2022, Seungbae Yu <dbadoy4874@gmail.com>
+// All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package pingu
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+)
+
+// Beater sends heartbeats to the collectors every interval, push mode. It
+// suits the pingus that can send but not receive, behind a one-way firewall.
+//
+// A collector is a Pingu that registered the beater's Pingu. It takes the
+// beats as proofs of life, doesn't probe the beater, and marks it dead if no
+// beat arrives within the declared interval times Config.BeatGrace, and
+// probes it again then. The beats carry the ID of the beater, the raw address
+// the collectors registered, so they are matched even if the source address
+// changes, behind a NAT or after a restart, see AllowBeatSource.
+type Beater struct {
+	p          *Pingu
+	interval   time.Duration
+	collectors []*net.UDPAddr
+
+	mu     sync.Mutex
+	id     string
+	cancel chan struct{}
+}
+
+// NewBeater returns a Beater sending the heartbeats with the Pingu's socket.
+// The Pingu doesn't need to be started.
+func NewBeater(p *Pingu, interval time.Duration, collectors ...string) (*Beater, error) {
+	if interval < time.Millisecond {
+		return nil, fmt.Errorf("invalid beat interval: %v", interval)
+	}
+	addrs := make([]*net.UDPAddr, 0, len(collectors))
+	for _, raw := range collectors {
+		addr, err := rawAddrToUDPAddr(raw)
+		if err != nil {
+			return nil, err
+		}
+		addrs = append(addrs, addr)
+	}
+	return &Beater{p: p, interval: interval, collectors: addrs, id: p.self}, nil
+}
+
+// SetID sets the raw address the collectors registered the beater with,
+// default value : the listen address of the Pingu. It must be set if the
+// Pingu listens on an unspecified address, or if the collectors know the
+// beater by another address, like the one of its NAT. The collectors take
+// the beats from another address only if they allow it, see
+// AllowBeatSource.
+func (b *Beater) SetID(raw string) error {
+	if _, err := rawAddrToUDPAddr(raw); err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.id = raw
+	return nil
+}
+
+// Start starts sending the heartbeats.
+func (b *Beater) Start() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.cancel != nil {
+		return
+	}
+	b.cancel = make(chan struct{})
+	go b.loop(b.cancel)
+}
+
+// Stop stops sending the heartbeats.
+func (b *Beater) Stop() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.cancel == nil {
+		return
+	}
+	close(b.cancel)
+	b.cancel = nil
+}
+
+func (b *Beater) loop(cancel chan struct{}) {
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+	for {
+		b.beat()
+		select {
+		case <-ticker.C:
+		case <-cancel:
+			return
+		}
+	}
+}
+
+func (b *Beater) beat() {
+	b.mu.Lock()
+	id := b.id
+	b.mu.Unlock()
+	for _, addr := range b.collectors {
+		if _, err := b.p.send(addr, &beatPacket{Interval: b.interval.Milliseconds(), ID: id}); err != nil {
+			b.p.logSendError(err)
+		}
+	}
+}
+
+// recvBeat marks the registered pingu alive until its next beat is due. The
+// pingu is the one of the ID of the beat, or of its sender if it has none.
+// The beat of a scheduled job goes to its check.
+func (p *Pingu) recvBeat(b *beatPacket) {
+	if b.Check != "" {
+		p.recvCheck(b)
+		return
+	}
+	rawAddr := b.ID
+	if rawAddr == "" {
+		rawAddr = b.Sender().String()
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.wl[rawAddr] || b.Interval <= 0 {
+		return
+	}
+	if !p.allowedBeat(rawAddr, b.Sender()) {
+		if p.cfg.Verbose {
+			log.Printf("[pingu] dropped beat of %v from %v\n", rawAddr, b.Sender())
+		}
+		return
+	}
+	grace := p.cfg.BeatGrace
+	if grace < 1 {
+		grace = DefaultBeatGrace
+	}
+	st := p.peer(rawAddr)
+	st.lastSeen = time.Now()
+	st.beatInterval = time.Duration(b.Interval) * time.Millisecond
+	st.beatSeq++
+	if st.beatTimer != nil {
+		st.beatTimer.Stop()
+	}
+	seq := st.beatSeq
+	st.beatTimer = time.AfterFunc(time.Duration(float64(st.beatInterval)*grace), func() {
+		p.missBeat(rawAddr, st, seq)
+	})
+	p.setHealth(rawAddr, Alive)
+}
+
+// missBeat marks the pingu dead, unless it did beat since.
+func (p *Pingu) missBeat(rawAddr string, st *peer, seq uint64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.peers[rawAddr] != st || st.beatSeq != seq {
+		return
+	}
+	// Not in push mode anymore, the pingu is probed again.
+	st.beatInterval = 0
+	p.setHealth(rawAddr, Dead)
+}
+
+// AllowBeatSource lets the registered pingu at raw beat from the sources,
+// IP addresses with any port or raw addresses, as well as from raw itself,
+// see Beater.SetID. No source removes the allowance.
+func (p *Pingu) AllowBeatSource(raw string, sources ...string) error {
+	allowed := make([]string, 0, len(sources))
+	for _, s := range sources {
+		if ap, err := netip.ParseAddrPort(s); err == nil {
+			allowed = append(allowed, ap.String())
+			continue
+		}
+		ip, err := netip.ParseAddr(s)
+		if err != nil {
+			return fmt.Errorf("invalid beat source: %q", s)
+		}
+		allowed = append(allowed, ip.String())
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(allowed) == 0 {
+		delete(p.beatSources, raw)
+		return nil
+	}
+	if p.beatSources == nil {
+		p.beatSources = make(map[string][]string)
+	}
+	p.beatSources[raw] = allowed
+	return nil
+}
+
+// allowedBeat reports whether the sender may beat for the pingu at rawAddr.
+//
+// The caller must hold p.mu.
+func (p *Pingu) allowedBeat(rawAddr string, sender *net.UDPAddr) bool {
+	ap := sender.AddrPort()
+	ap = netip.AddrPortFrom(ap.Addr().Unmap(), ap.Port())
+	if ap.String() == rawAddr {
+		return true
+	}
+	for _, s := range p.beatSources[rawAddr] {
+		if s == ap.String() || s == ap.Addr().String() {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,182 @@
+package pingu_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/protocol-diver/pingu"
+)
+
+func TestBeater(t *testing.T) {
+	collector, err := pingu.NewPingu("127.0.0.1:9690", nil)
+	if err != nil {
+		t.Fatalf("Beater NewPingu failure %v", err)
+	}
+	defer collector.Close()
+	// The agent never starts, it can't receive.
+	agent, err := pingu.NewPingu("127.0.0.1:9691", nil)
+	if err != nil {
+		t.Fatalf("Beater NewPingu failure %v", err)
+	}
+	defer agent.Close()
+
+	collector.Start()
+	collector.RegisterWithRawAddr("127.0.0.1:9691")
+	err = collector.StartProbing(pingu.ProbeOptions{Interval: 10 * time.Millisecond, Timeout: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("Beater StartProbing failure %v", err)
+	}
+
+	if _, err := pingu.NewBeater(agent, 0, "127.0.0.1:9690"); err == nil {
+		t.Fatalf("NewBeater failure: accepted zero interval")
+	}
+	beater, err := pingu.NewBeater(agent, 20*time.Millisecond, "127.0.0.1:9690")
+	if err != nil {
+		t.Fatalf("NewBeater failure %v", err)
+	}
+	beater.Start()
+
+	time.Sleep(100 * time.Millisecond)
+	st, ok := collector.PeerState("127.0.0.1:9691")
+	if !ok || st.Health != pingu.Alive || st.BeatInterval != 20*time.Millisecond {
+		t.Fatalf("Beater invalid state: %+v", st)
+	}
+
+	beater.Stop()
+	time.Sleep(60 * time.Millisecond)
+	if collector.IsAlive("127.0.0.1:9691") {
+		t.Fatalf("Beater invalid result: %v", collector.PingTable())
+	}
+}
+
+func TestBeaterID(t *testing.T) {
+	collector, err := pingu.NewPingu("127.0.0.1:11890", nil)
+	if err != nil {
+		t.Fatalf("Beater NewPingu failure %v", err)
+	}
+	defer collector.Close()
+	collector.Start()
+	// The collector knows the beater by the address of its NAT.
+	id := "10.0.0.9:4874"
+	collector.RegisterWithRawAddr(id)
+	if err := collector.AllowBeatSource(id, "127.0.0.1.1"); err == nil {
+		t.Fatalf("AllowBeatSource expected failure on invalid source")
+	}
+
+	agents := make([]*pingu.Beater, 0, 2)
+	for _, addr := range []string{"127.0.0.1:11891", "127.0.0.1:11892"} {
+		agent, err := pingu.NewPingu(addr, nil)
+		if err != nil {
+			t.Fatalf("Beater NewPingu failure %v", err)
+		}
+		defer agent.Close()
+		beater, err := pingu.NewBeater(agent, 20*time.Millisecond, "127.0.0.1:11890")
+		if err != nil {
+			t.Fatalf("NewBeater failure %v", err)
+		}
+		if err := beater.SetID("10.0.0.9"); err == nil {
+			t.Fatalf("SetID expected failure on invalid address")
+		}
+		if err := beater.SetID(id); err != nil {
+			t.Fatalf("SetID failure %v", err)
+		}
+		agents = append(agents, beater)
+	}
+
+	// Not allowed yet.
+	agents[0].Start()
+	time.Sleep(50 * time.Millisecond)
+	if _, ok := collector.PeerState(id); ok {
+		t.Fatalf("Beater invalid state: a beat from a source not allowed is taken")
+	}
+
+	if err := collector.AllowBeatSource(id, "127.0.0.1"); err != nil {
+		t.Fatalf("AllowBeatSource failure %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if st, ok := collector.PeerState(id); !ok || st.Health != pingu.Alive || st.BeatInterval != 20*time.Millisecond {
+		t.Fatalf("Beater invalid state: %+v", st)
+	}
+	if _, ok := collector.PeerState("127.0.0.1:11891"); ok {
+		t.Fatalf("Beater invalid state: the source address is tracked")
+	}
+
+	// Restarted from another port, the beater stays alive.
+	agents[0].Stop()
+	agents[1].Start()
+	defer agents[1].Stop()
+	time.Sleep(100 * time.Millisecond)
+	if !collector.IsAlive(id) {
+		t.Fatalf("Beater invalid result: %v", collector.PingTable())
+	}
+}
+
+func TestBeaterSpoofed(t *testing.T) {
+	addrs := []string{"127.0.0.1:11893", "127.0.0.1:11894", "127.0.0.1:11895"}
+	pingus := make([]*pingu.Pingu, 0, len(addrs))
+	for _, addr := range addrs {
+		p, err := pingu.NewPingu(addr, nil)
+		if err != nil {
+			t.Fatalf("Beater NewPingu failure %v", err)
+		}
+		defer p.Close()
+		p.Start()
+		pingus = append(pingus, p)
+	}
+	collector := pingus[0]
+	collector.RegisterWithRawAddr(addrs[1])
+	collector.RegisterWithRawAddr(addrs[2])
+	if err := collector.StartProbing(pingu.ProbeOptions{Interval: 10 * time.Millisecond, Timeout: 10 * time.Millisecond}); err != nil {
+		t.Fatalf("Beater StartProbing failure %v", err)
+	}
+
+	// The third pingu beats once in the name of the second one.
+	spoofer, err := pingu.NewBeater(pingus[2], 5*time.Millisecond, addrs[0])
+	if err != nil {
+		t.Fatalf("NewBeater failure %v", err)
+	}
+	spoofer.SetID(addrs[1])
+	spoofer.Start()
+	time.Sleep(2 * time.Millisecond)
+	spoofer.Stop()
+
+	time.Sleep(100 * time.Millisecond)
+	if st, _ := collector.PeerState(addrs[1]); st.Health != pingu.Alive || st.BeatInterval != 0 {
+		t.Fatalf("Beater invalid state: %+v", st)
+	}
+}
+
+func TestBeaterProbedAgain(t *testing.T) {
+	addrs := []string{"127.0.0.1:11896", "127.0.0.1:11897"}
+	pingus := make([]*pingu.Pingu, 0, len(addrs))
+	for _, addr := range addrs {
+		p, err := pingu.NewPingu(addr, nil)
+		if err != nil {
+			t.Fatalf("Beater NewPingu failure %v", err)
+		}
+		defer p.Close()
+		p.Start()
+		pingus = append(pingus, p)
+	}
+	collector := pingus[0]
+	collector.RegisterWithRawAddr(addrs[1])
+	if err := collector.StartProbing(pingu.ProbeOptions{Interval: 10 * time.Millisecond, Timeout: 10 * time.Millisecond}); err != nil {
+		t.Fatalf("Beater StartProbing failure %v", err)
+	}
+	beater, err := pingu.NewBeater(pingus[1], 20*time.Millisecond, addrs[0])
+	if err != nil {
+		t.Fatalf("NewBeater failure %v", err)
+	}
+	beater.Start()
+	time.Sleep(50 * time.Millisecond)
+	if st, _ := collector.PeerState(addrs[1]); st.BeatInterval == 0 {
+		t.Fatalf("Beater invalid state: %+v", st)
+	}
+
+	// The beats stop, the pingu still answers the probes.
+	beater.Stop()
+	time.Sleep(150 * time.Millisecond)
+	if st, _ := collector.PeerState(addrs[1]); st.Health != pingu.Alive || st.BeatInterval != 0 {
+		t.Fatalf("Beater invalid state: %+v", st)
+	}
+}
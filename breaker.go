@@ -0,0 +1,313 @@
+// Copyright (c) 2022, Seungbae Yu <dbadoy4874@gmail.com>
+// All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package pingu
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// The defaults of BreakerOptions.
+const (
+	DefaultBreakerErrorRate = 0.5
+	DefaultBreakerMinCalls  = 10
+	DefaultBreakerWindow    = 10 * time.Second
+	DefaultBreakerCooldown  = 5 * time.Second
+
+	// The outcomes are counted in buckets, the oldest one is dropped as the
+	// window slides.
+	breakerBuckets = 10
+)
+
+// BreakerState is the state of a circuit breaker.
+type BreakerState uint8
+
+const (
+	// BreakerClosed lets the calls through.
+	BreakerClosed BreakerState = 1 + iota
+	// BreakerOpen rejects the calls.
+	BreakerOpen
+	// BreakerHalfOpen lets one trial call through once the pingu is alive.
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return fmt.Sprintf("breaker(%d)", s)
+	}
+}
+
+// BreakerOptions configures Breakers.
+type BreakerOptions struct {
+	// ErrorRate is the rate of the failed calls over Window opening the
+	// breaker, DefaultBreakerErrorRate if 0.
+	ErrorRate float64
+	// MinCalls is the number of calls over Window needed before the rate
+	// counts, DefaultBreakerMinCalls if 0.
+	MinCalls int
+	// Window is the duration the calls are counted over,
+	// DefaultBreakerWindow if 0.
+	Window time.Duration
+	// Cooldown is the time an open breaker waits before going half-open,
+	// DefaultBreakerCooldown if 0.
+	Cooldown time.Duration
+}
+
+// Breakers are circuit breakers keyed by the raw address of the pingus. A
+// breaker opens when the pingu is dead or too many calls to it failed. After
+// the cooldown it goes half-open, and it closes once the pingu is alive and a
+// trial call succeeds.
+type Breakers struct {
+	p    *Pingu
+	opts BreakerOptions
+
+	mu       sync.Mutex
+	breakers map[string]*breaker
+
+	cancel chan struct{}
+	once   sync.Once
+}
+
+type breaker struct {
+	state BreakerState
+	// trial reports whether the trial call of a half-open breaker is out.
+	trial bool
+
+	buckets [breakerBuckets]struct{ calls, failures int }
+	// bucket is the index of the current bucket, started at 'since'.
+	bucket int
+	since  time.Time
+
+	// seq identifies the current opening for the cooldown timer.
+	timer *time.Timer
+	seq   uint64
+}
+
+// NewBreakers returns the circuit breakers following the health changes.
+// Use Breakers.Stop to stop them.
+func (p *Pingu) NewBreakers(opts BreakerOptions) *Breakers {
+	if opts.ErrorRate <= 0 {
+		opts.ErrorRate = DefaultBreakerErrorRate
+	}
+	if opts.MinCalls <= 0 {
+		opts.MinCalls = DefaultBreakerMinCalls
+	}
+	if opts.Window <= 0 {
+		opts.Window = DefaultBreakerWindow
+	}
+	if opts.Cooldown <= 0 {
+		opts.Cooldown = DefaultBreakerCooldown
+	}
+	b := &Breakers{p: p, opts: opts, breakers: make(map[string]*breaker), cancel: make(chan struct{})}
+	changed := p.watch()
+	b.follow()
+	go b.loop(changed)
+	return b
+}
+
+// Allow reports whether a call to the pingu may go through. The outcome of
+// an allowed call must be reported with Report.
+func (b *Breakers) Allow(rawAddr string) bool {
+	b.p.mu.Lock()
+	defer b.p.mu.Unlock()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	br := b.breaker(rawAddr)
+	switch br.state {
+	case BreakerClosed:
+		return true
+	case BreakerHalfOpen:
+		if br.trial || !b.alive(rawAddr) {
+			return false
+		}
+		br.trial = true
+		return true
+	default:
+		return false
+	}
+}
+
+// Report records the outcome of a call to the pingu, failed if err is not
+// nil.
+func (b *Breakers) Report(rawAddr string, err error) {
+	b.p.mu.Lock()
+	defer b.p.mu.Unlock()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	br := b.breaker(rawAddr)
+	now := time.Now()
+	switch br.state {
+	case BreakerClosed:
+		br.count(err != nil, now, b.opts.Window)
+		calls, failures := br.total()
+		if calls >= b.opts.MinCalls && float64(failures) >= b.opts.ErrorRate*float64(calls) {
+			b.open(rawAddr, br, now)
+		}
+	case BreakerHalfOpen:
+		if !br.trial {
+			return
+		}
+		br.trial = false
+		if err != nil || !b.alive(rawAddr) {
+			b.open(rawAddr, br, now)
+			return
+		}
+		b.setState(rawAddr, br, BreakerClosed, now)
+	}
+}
+
+// State returns the state of the breaker of the pingu.
+func (b *Breakers) State(rawAddr string) BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if br, ok := b.breakers[rawAddr]; ok {
+		return br.state
+	}
+	return BreakerClosed
+}
+
+// Stop stops following the health changes.
+func (b *Breakers) Stop() {
+	b.once.Do(func() {
+		close(b.cancel)
+	})
+}
+
+func (b *Breakers) loop(changed chan struct{}) {
+	defer b.p.unwatch(changed)
+	for {
+		select {
+		case <-changed:
+			b.follow()
+		case <-b.cancel:
+			return
+		}
+	}
+}
+
+// follow opens the closed breakers of the dead pingus. The half-open ones
+// wait for the pingu to be alive before letting the trial through.
+func (b *Breakers) follow() {
+	b.p.mu.Lock()
+	defer b.p.mu.Unlock()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	for addr, st := range b.p.peers {
+		if st.health != Dead || !b.p.wl[addr] {
+			continue
+		}
+		if br := b.breaker(addr); br.state == BreakerClosed {
+			b.open(addr, br, now)
+		}
+	}
+}
+
+// alive reports whether the pingu is not known dead. The pingus not
+// registered count as alive, only the calls open their breakers.
+//
+// The caller must hold b.p.mu.
+func (b *Breakers) alive(rawAddr string) bool {
+	st, ok := b.p.peers[rawAddr]
+	return !ok || !b.p.wl[rawAddr] || st.health != Dead
+}
+
+// breaker returns the breaker of the pingu, created closed.
+//
+// The caller must hold b.mu.
+func (b *Breakers) breaker(rawAddr string) *breaker {
+	br, ok := b.breakers[rawAddr]
+	if !ok {
+		br = &breaker{state: BreakerClosed}
+		b.breakers[rawAddr] = br
+	}
+	return br
+}
+
+// open opens the breaker, and goes half-open after the cooldown.
+//
+// The caller must hold b.p.mu and b.mu.
+func (b *Breakers) open(rawAddr string, br *breaker, now time.Time) {
+	b.setState(rawAddr, br, BreakerOpen, now)
+	br.trial = false
+	if br.timer != nil {
+		br.timer.Stop()
+	}
+	br.seq++
+	seq := br.seq
+	br.timer = time.AfterFunc(b.opts.Cooldown, func() {
+		b.halfOpen(rawAddr, br, seq)
+	})
+}
+
+// halfOpen lets a trial call through, unless the breaker opened again since.
+func (b *Breakers) halfOpen(rawAddr string, br *breaker, seq uint64) {
+	b.p.mu.Lock()
+	defer b.p.mu.Unlock()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if br.seq != seq || br.state != BreakerOpen {
+		return
+	}
+	b.setState(rawAddr, br, BreakerHalfOpen, time.Now())
+}
+
+// setState updates the state of the breaker and sends the event if changed.
+// The calls counted so far are forgotten.
+//
+// The caller must hold b.p.mu and b.mu.
+func (b *Breakers) setState(rawAddr string, br *breaker, s BreakerState, now time.Time) {
+	if br.state == s {
+		return
+	}
+	br.state = s
+	br.buckets = [breakerBuckets]struct{ calls, failures int }{}
+	var t EventType
+	switch s {
+	case BreakerOpen:
+		t = EventBreakerOpened
+	case BreakerHalfOpen:
+		t = EventBreakerHalfOpen
+	case BreakerClosed:
+		t = EventBreakerClosed
+	}
+	b.p.emit(Event{Type: t, Addr: rawAddr, Time: now})
+}
+
+// count records a call in the current bucket, after dropping the buckets
+// that slid out of the window.
+func (br *breaker) count(failed bool, now time.Time, window time.Duration) {
+	width := window / breakerBuckets
+	for i := 0; now.Sub(br.since) >= width && i < breakerBuckets; i++ {
+		br.bucket = (br.bucket + 1) % breakerBuckets
+		br.buckets[br.bucket] = struct{ calls, failures int }{}
+		br.since = br.since.Add(width)
+	}
+	if now.Sub(br.since) >= width {
+		br.since = now
+	}
+	br.buckets[br.bucket].calls++
+	if failed {
+		br.buckets[br.bucket].failures++
+	}
+}
+
+func (br *breaker) total() (calls, failures int) {
+	for _, c := range br.buckets {
+		calls += c.calls
+		failures += c.failures
+	}
+	return calls, failures
+}
@@ -0,0 +1,112 @@
+package pingu_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/protocol-diver/pingu"
+)
+
+func TestBreakerErrors(t *testing.T) {
+	p, err := pingu.NewPingu("127.0.0.1:10290", nil)
+	if err != nil {
+		t.Fatalf("Breaker NewPingu failure %v", err)
+	}
+	defer p.Close()
+	b := p.NewBreakers(pingu.BreakerOptions{MinCalls: 4, ErrorRate: 0.5, Cooldown: 50 * time.Millisecond})
+	defer b.Stop()
+
+	addr := "127.0.0.1:10291"
+	fail := errors.New("call failed")
+	for _, err := range []error{nil, fail, nil} {
+		if !b.Allow(addr) {
+			t.Fatalf("Breaker invalid Allow, state: %v", b.State(addr))
+		}
+		b.Report(addr, err)
+	}
+	if s := b.State(addr); s != pingu.BreakerClosed {
+		t.Fatalf("Breaker invalid state got: %v, want: %v", s, pingu.BreakerClosed)
+	}
+	b.Report(addr, fail)
+	if s := b.State(addr); s != pingu.BreakerOpen || b.Allow(addr) {
+		t.Fatalf("Breaker invalid state got: %v, want: %v", s, pingu.BreakerOpen)
+	}
+
+	// A failed trial opens it again.
+	time.Sleep(70 * time.Millisecond)
+	if s := b.State(addr); s != pingu.BreakerHalfOpen {
+		t.Fatalf("Breaker invalid state got: %v, want: %v", s, pingu.BreakerHalfOpen)
+	}
+	if !b.Allow(addr) || b.Allow(addr) {
+		t.Fatalf("Breaker half-open must allow one trial")
+	}
+	b.Report(addr, fail)
+	if s := b.State(addr); s != pingu.BreakerOpen {
+		t.Fatalf("Breaker invalid state got: %v, want: %v", s, pingu.BreakerOpen)
+	}
+
+	time.Sleep(70 * time.Millisecond)
+	if !b.Allow(addr) {
+		t.Fatalf("Breaker half-open must allow one trial")
+	}
+	b.Report(addr, nil)
+	if s := b.State(addr); s != pingu.BreakerClosed {
+		t.Fatalf("Breaker invalid state got: %v, want: %v", s, pingu.BreakerClosed)
+	}
+}
+
+func TestBreakerHealth(t *testing.T) {
+	addrs := []string{"127.0.0.1:10292", "127.0.0.1:10293"}
+	p, err := pingu.NewPingu(addrs[0], nil)
+	if err != nil {
+		t.Fatalf("Breaker NewPingu failure %v", err)
+	}
+	defer p.Close()
+	p.Start()
+	p.RegisterWithRawAddr(addrs[1])
+	if err := p.StartProbing(pingu.ProbeOptions{Interval: 10 * time.Millisecond, Timeout: 10 * time.Millisecond}); err != nil {
+		t.Fatalf("Breaker StartProbing failure %v", err)
+	}
+	b := p.NewBreakers(pingu.BreakerOptions{Cooldown: 30 * time.Millisecond})
+	defer b.Stop()
+	sub := p.Subscribe(16)
+	defer sub.Unsubscribe()
+
+	// Dead, open, then half-open but no trial while dead.
+	time.Sleep(100 * time.Millisecond)
+	if s := b.State(addrs[1]); s != pingu.BreakerHalfOpen || b.Allow(addrs[1]) {
+		t.Fatalf("Breaker invalid state got: %v, want: %v", s, pingu.BreakerHalfOpen)
+	}
+
+	other, err := pingu.NewPingu(addrs[1], nil)
+	if err != nil {
+		t.Fatalf("Breaker NewPingu failure %v", err)
+	}
+	defer other.Close()
+	other.Start()
+	time.Sleep(50 * time.Millisecond)
+	if !b.Allow(addrs[1]) {
+		t.Fatalf("Breaker must allow the trial once alive")
+	}
+	b.Report(addrs[1], nil)
+	if s := b.State(addrs[1]); s != pingu.BreakerClosed {
+		t.Fatalf("Breaker invalid state got: %v, want: %v", s, pingu.BreakerClosed)
+	}
+
+	var types []pingu.EventType
+	for len(sub.Events()) != 0 {
+		if e := <-sub.Events(); e.Addr == addrs[1] && e.Type >= pingu.EventBreakerOpened {
+			types = append(types, e.Type)
+		}
+	}
+	want := []pingu.EventType{pingu.EventBreakerOpened, pingu.EventBreakerHalfOpen, pingu.EventBreakerClosed}
+	if len(types) != len(want) {
+		t.Fatalf("Breaker invalid events got: %v, want: %v", types, want)
+	}
+	for i := range want {
+		if types[i] != want[i] {
+			t.Fatalf("Breaker invalid events got: %v, want: %v", types, want)
+		}
+	}
+}
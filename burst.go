@@ -0,0 +1,198 @@
+// Copyright (c) 2022, Seungbae Yu <dbadoy4874@gmail.com>
+// All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package pingu
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// burstLinger is how long a burst waits for the pongs after its last ping.
+const burstLinger = time.Second
+
+// BurstReport is the result of a burst of pings, see Burst.
+type BurstReport struct {
+	Sent     int
+	Received int
+	// Duplicated counts the extra pongs of a ping. Reordered counts the
+	// pongs arrived after the pong of a later ping.
+	Duplicated int
+	Reordered  int
+	// LastError is the last error sending the pings, a SendError, nil if
+	// all of them were sent. A ping not sent is lost.
+	LastError error
+
+	// RTTs are the RTTs of the pings in the order sent, zero if lost.
+	RTTs []time.Duration
+	// The spread of the RTTs of the pongs received.
+	MinRTT    time.Duration
+	MaxRTT    time.Duration
+	MeanRTT   time.Duration
+	StdDevRTT time.Duration
+	P50       time.Duration
+	P90       time.Duration
+	P99       time.Duration
+}
+
+// Lost returns the number of the pings not answered.
+func (r *BurstReport) Lost() int {
+	return r.Sent - r.Received
+}
+
+// LossRate returns the rate of the pings not answered, 0 if none was sent.
+func (r *BurstReport) LossRate() float64 {
+	if r.Sent == 0 {
+		return 0
+	}
+	return float64(r.Lost()) / float64(r.Sent)
+}
+
+// Burst sends count pings to the pingu at raw, spacing apart, and reports
+// their loss and RTTs. It waits for the pongs up to a second after the last
+// ping, less if all of the pings sent were answered, and returns early with
+// the context error if the context is done. The Pingu must be started.
+//
+// The burst is measured on its own: it doesn't change the health, RTT or
+// statistics of the pingu.
+func (p *Pingu) Burst(ctx context.Context, raw string, count int, spacing time.Duration) (*BurstReport, error) {
+	if count < 1 {
+		return nil, fmt.Errorf("invalid burst count: %d", count)
+	}
+	if spacing < 0 {
+		return nil, fmt.Errorf("invalid burst spacing: %v", spacing)
+	}
+	addr, err := rawAddrToUDPAddr(raw)
+	if err != nil {
+		return nil, err
+	}
+	if !p.running() {
+		return nil, ErrNotRunning
+	}
+
+	// Room for a duplicate of each pong, the next ones are dropped.
+	recv := make(chan packet, 2*count)
+	index := make(map[uint32]int, count)
+	nonces := make([]uint32, 0, count)
+	defer func() { p.unwait(nonces) }()
+	sentAt := make([]time.Time, count)
+
+	report := &BurstReport{RTTs: make([]time.Duration, count)}
+	// latest is the index of the latest ping answered, sent the number of
+	// pings that left.
+	latest, sent := -1, 0
+	receive := func(r packet) {
+		i, ok := index[r.Header().Nonce]
+		if !ok {
+			return
+		}
+		if report.RTTs[i] != 0 {
+			report.Duplicated++
+			return
+		}
+		pong := r.(*pongPacket)
+		at := pong.recvAt
+		if at.IsZero() {
+			at = time.Now()
+		}
+		rtt := at.Sub(sentAt[i])
+		if rtt <= 0 {
+			rtt = 1
+		}
+		report.RTTs[i] = rtt
+		report.Received++
+		if i < latest {
+			report.Reordered++
+		} else {
+			latest = i
+		}
+	}
+
+	var tick <-chan time.Time
+	if spacing > 0 {
+		ticker := time.NewTicker(spacing)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for i := 0; i < count; i++ {
+		if i > 0 && tick != nil {
+		wait:
+			for {
+				select {
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				case r := <-recv:
+					receive(r)
+				case <-tick:
+					break wait
+				}
+			}
+		}
+		nonce := p.addWaiter(&waiter{rawAddr: addr.String(), recv: recv, dups: true})
+		nonces = append(nonces, nonce)
+		index[nonce] = i
+		sentAt[i] = time.Now()
+		report.Sent++
+		if _, err := p.send(addr, &pingPacket{header: header{Nonce: nonce}}); err != nil {
+			report.LastError = err
+			p.logSendError(err)
+			continue
+		}
+		sent++
+	}
+
+	timer := time.NewTimer(burstLinger)
+	defer timer.Stop()
+	for report.Received < sent {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case r := <-recv:
+			receive(r)
+		case <-timer.C:
+			report.spread()
+			return report, nil
+		}
+	}
+	// Take the duplicates already there.
+	for len(recv) > 0 {
+		receive(<-recv)
+	}
+	report.spread()
+	return report, nil
+}
+
+// spread computes the spread of the RTTs received.
+func (r *BurstReport) spread() {
+	rtts := make([]time.Duration, 0, r.Received)
+	for _, rtt := range r.RTTs {
+		if rtt != 0 {
+			rtts = append(rtts, rtt)
+		}
+	}
+	if len(rtts) == 0 {
+		return
+	}
+	sort.Slice(rtts, func(i, j int) bool { return rtts[i] < rtts[j] })
+	r.MinRTT, r.MaxRTT = rtts[0], rtts[len(rtts)-1]
+	var sum float64
+	for _, rtt := range rtts {
+		sum += float64(rtt)
+	}
+	mean := sum / float64(len(rtts))
+	var sq float64
+	for _, rtt := range rtts {
+		sq += (float64(rtt) - mean) * (float64(rtt) - mean)
+	}
+	r.MeanRTT = time.Duration(mean)
+	r.StdDevRTT = time.Duration(math.Sqrt(sq / float64(len(rtts))))
+	r.P50 = quantile(rtts, 0.5)
+	r.P90 = quantile(rtts, 0.9)
+	r.P99 = quantile(rtts, 0.99)
+}
@@ -0,0 +1,67 @@
+package pingu_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/protocol-diver/pingu"
+)
+
+func TestBurst(t *testing.T) {
+	addrs := []string{"127.0.0.1:11090", "127.0.0.1:11091", "127.0.0.1:11092"}
+	pingus := make([]*pingu.Pingu, 0, len(addrs))
+	for _, addr := range addrs[:2] {
+		p, err := pingu.NewPingu(addr, nil)
+		if err != nil {
+			t.Fatalf("Burst NewPingu failure %v", err)
+		}
+		defer p.Close()
+		p.Start()
+		pingus = append(pingus, p)
+	}
+	p := pingus[0]
+	p.RegisterWithRawAddr(addrs[1])
+
+	r, err := p.Burst(context.Background(), addrs[1], 20, time.Millisecond)
+	if err != nil {
+		t.Fatalf("Burst failure %v", err)
+	}
+	if r.Sent != 20 || r.Received != 20 || r.Lost() != 0 || r.Duplicated != 0 {
+		t.Fatalf("Burst invalid report got: %+v, want: %v sent and received", r, 20)
+	}
+	if r.MinRTT <= 0 || r.MinRTT > r.P50 || r.P50 > r.P90 || r.P90 > r.P99 || r.P99 > r.MaxRTT {
+		t.Fatalf("Burst invalid RTT spread got: %+v", r)
+	}
+	for i, rtt := range r.RTTs {
+		if rtt <= 0 {
+			t.Fatalf("Burst invalid RTT %d got: %v", i, rtt)
+		}
+	}
+
+	// The burst leaves the pingu as it was.
+	if st, _ := p.PeerState(addrs[1]); st.RTT != 0 {
+		t.Fatalf("PeerState invalid RTT got: %v, want: %v", st.RTT, 0)
+	}
+	if s, _ := p.PeerStats(addrs[1]); s.Packets1m.Sent != 0 || s.RTT1m.Count != 0 {
+		t.Fatalf("PeerStats invalid stats got: %+v, want: none", s)
+	}
+
+	// No one there.
+	r, err = p.Burst(context.Background(), addrs[2], 5, 0)
+	if err != nil {
+		t.Fatalf("Burst failure %v", err)
+	}
+	if r.Sent != 5 || r.Received != 0 || r.LossRate() != 1 || r.MaxRTT != 0 {
+		t.Fatalf("Burst invalid report got: %+v, want: all lost", r)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := p.Burst(ctx, addrs[2], 5, 0); err != context.DeadlineExceeded {
+		t.Fatalf("Burst failure got: %v, want: %v", err, context.DeadlineExceeded)
+	}
+	if _, err := p.Burst(context.Background(), addrs[1], 0, 0); err == nil {
+		t.Fatalf("Burst expected failure on zero count")
+	}
+}
@@ -0,0 +1,230 @@
+// Copyright (c) 2022, Seungbae Yu <dbadoy4874@gmail.com>
+// All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package pingu
+
+import (
+	"fmt"
+	"net"
+	"time"
+)
+
+// CheckStatus is the status of a check, see RegisterCheck.
+type CheckStatus uint8
+
+const (
+	// CheckPending is the status of a check that never beat, before it's due.
+	CheckPending CheckStatus = 1 + iota
+	// CheckUp is the status of a check that beat on time with exit status 0.
+	CheckUp
+	// CheckFailed is the status of a check that beat with a non-zero exit
+	// status.
+	CheckFailed
+	// CheckLate is the status of a check that didn't beat on time, in its
+	// grace period.
+	CheckLate
+	// CheckMissing is the status of a check that didn't beat by the end of
+	// its grace period.
+	CheckMissing
+)
+
+func (s CheckStatus) String() string {
+	switch s {
+	case CheckPending:
+		return "pending"
+	case CheckUp:
+		return "up"
+	case CheckFailed:
+		return "failed"
+	case CheckLate:
+		return "late"
+	case CheckMissing:
+		return "missing"
+	default:
+		return fmt.Sprintf("check(%d)", s)
+	}
+}
+
+// CheckState is the state of a check.
+type CheckState struct {
+	Status CheckStatus
+	// LastBeat is the time of the last beat, ExitStatus its exit status.
+	LastBeat   time.Time
+	ExitStatus int
+	// Due is the time the next beat is expected by.
+	Due time.Time
+}
+
+// check is a dead man's switch of a scheduled job.
+type check struct {
+	schedule Schedule
+	grace    time.Duration
+	state    CheckState
+
+	// seq identifies the current deadline for its timer.
+	timer *time.Timer
+	seq   uint64
+}
+
+// RegisterCheck registers a check of a scheduled job. The job proves it ran
+// by a beat with the check name, see SendBeat. If the beat doesn't arrive by
+// the next run time of the schedule, the check is late, and missing after
+// the grace period. Registering an existing check resets it. A schedule that
+// never runs, or doesn't move forward, is invalid.
+func (p *Pingu) RegisterCheck(name string, schedule Schedule, grace time.Duration) error {
+	if name == "" {
+		return fmt.Errorf("invalid check name: %q", name)
+	}
+	if schedule == nil {
+		return fmt.Errorf("invalid check schedule: %v", schedule)
+	}
+	now := time.Now()
+	switch next := schedule.Next(now); {
+	case next.IsZero():
+		return fmt.Errorf("invalid check schedule: never runs")
+	case !next.After(now):
+		return fmt.Errorf("invalid check schedule: next run %v not after %v", next, now)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if c, ok := p.checks[name]; ok && c.timer != nil {
+		c.timer.Stop()
+	}
+	c := &check{schedule: schedule, grace: grace, state: CheckState{Status: CheckPending}}
+	p.checks[name] = c
+	p.armCheck(name, c, now)
+	return nil
+}
+
+// UnregisterCheck removes the check.
+func (p *Pingu) UnregisterCheck(name string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if c, ok := p.checks[name]; ok {
+		if c.timer != nil {
+			c.timer.Stop()
+		}
+		delete(p.checks, name)
+	}
+}
+
+// CheckState returns the state of the check, false if it's not registered.
+func (p *Pingu) CheckState(name string) (CheckState, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	c, ok := p.checks[name]
+	if !ok {
+		return CheckState{}, false
+	}
+	return c.state, true
+}
+
+// Checks returns the state of the registered checks.
+func (p *Pingu) Checks() map[string]CheckState {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	r := make(map[string]CheckState, len(p.checks))
+	for name, c := range p.checks {
+		r[name] = c.state
+	}
+	return r
+}
+
+// SendBeat sends a one-shot beat of the check to the collector at rawAddr,
+// with the exit status of the job.
+func SendBeat(rawAddr string, name string, status int) error {
+	addr, err := rawAddrToUDPAddr(rawAddr)
+	if err != nil {
+		return err
+	}
+	conn, err := net.ListenUDP("udp", nil)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = sendPacket(conn, addr, &beatPacket{Check: name, Status: status})
+	return err
+}
+
+// recvCheck records the beat of a registered check.
+func (p *Pingu) recvCheck(b *beatPacket) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	c, ok := p.checks[b.Check]
+	if !ok {
+		return
+	}
+	now := time.Now()
+	c.state.LastBeat = now
+	c.state.ExitStatus = b.Status
+	if b.Status == 0 {
+		p.setCheckStatus(b.Check, c, CheckUp, now)
+	} else {
+		p.setCheckStatus(b.Check, c, CheckFailed, now)
+	}
+	p.armCheck(b.Check, c, now)
+}
+
+// armCheck sets the deadline of the next beat after 'from'.
+//
+// The caller must hold p.mu.
+func (p *Pingu) armCheck(name string, c *check, from time.Time) {
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+	c.seq++
+	c.state.Due = c.schedule.Next(from)
+	if c.state.Due.IsZero() {
+		return
+	}
+	seq := c.seq
+	c.timer = time.AfterFunc(time.Until(c.state.Due), func() {
+		p.lateCheck(name, c, seq)
+	})
+}
+
+// lateCheck marks the check late, then missing at the end of the grace.
+func (p *Pingu) lateCheck(name string, c *check, seq uint64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.checks[name] != c || c.seq != seq {
+		return
+	}
+	now := time.Now()
+	if c.grace <= 0 || c.state.Status == CheckLate {
+		p.setCheckStatus(name, c, CheckMissing, now)
+		return
+	}
+	p.setCheckStatus(name, c, CheckLate, now)
+	c.timer = time.AfterFunc(c.grace, func() {
+		p.lateCheck(name, c, seq)
+	})
+}
+
+// setCheckStatus updates the status of the check and sends the event if
+// changed.
+//
+// The caller must hold p.mu.
+func (p *Pingu) setCheckStatus(name string, c *check, s CheckStatus, now time.Time) {
+	if c.state.Status == s {
+		return
+	}
+	c.state.Status = s
+	var t EventType
+	switch s {
+	case CheckUp:
+		t = EventCheckUp
+	case CheckFailed:
+		t = EventCheckFailed
+	case CheckLate:
+		t = EventCheckLate
+	case CheckMissing:
+		t = EventCheckMissing
+	default:
+		return
+	}
+	p.emit(Event{Type: t, Name: name, Time: now})
+}
@@ -0,0 +1,52 @@
+package pingu_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/protocol-diver/pingu"
+)
+
+func TestCheck(t *testing.T) {
+	collector, err := pingu.NewPingu("127.0.0.1:9790", nil)
+	if err != nil {
+		t.Fatalf("Check NewPingu failure %v", err)
+	}
+	defer collector.Close()
+	collector.Start()
+
+	if err := collector.RegisterCheck("backup", pingu.Every(40*time.Millisecond), 40*time.Millisecond); err != nil {
+		t.Fatalf("RegisterCheck failure %v", err)
+	}
+	status := func() pingu.CheckStatus {
+		st, _ := collector.CheckState("backup")
+		return st.Status
+	}
+	if s := status(); s != pingu.CheckPending {
+		t.Fatalf("Check invalid status: %v, want: %v", s, pingu.CheckPending)
+	}
+
+	if err := pingu.SendBeat("127.0.0.1:9790", "backup", 0); err != nil {
+		t.Fatalf("SendBeat failure %v", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if s := status(); s != pingu.CheckUp {
+		t.Fatalf("Check invalid status: %v, want: %v", s, pingu.CheckUp)
+	}
+	time.Sleep(40 * time.Millisecond)
+	if s := status(); s != pingu.CheckLate {
+		t.Fatalf("Check invalid status: %v, want: %v", s, pingu.CheckLate)
+	}
+	time.Sleep(40 * time.Millisecond)
+	if s := status(); s != pingu.CheckMissing {
+		t.Fatalf("Check invalid status: %v, want: %v", s, pingu.CheckMissing)
+	}
+
+	if err := pingu.SendBeat("127.0.0.1:9790", "backup", 3); err != nil {
+		t.Fatalf("SendBeat failure %v", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if st, _ := collector.CheckState("backup"); st.Status != pingu.CheckFailed || st.ExitStatus != 3 {
+		t.Fatalf("Check invalid state: %+v", st)
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright (c) 2022, Seungbae Yu <dbadoy4874@gmail.com>
+// All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package pingu
+
+import "time"
+
+// The clock of a pingu is compared NTP style. The ping is sent at t1 and
+// received at t2 by the pingu, which sends the pong at t3, received at t4:
+//
+//	offset = ((t2 - t1) + (t3 - t4)) / 2
+//	delay  = (t4 - t1) - (t3 - t2)
+//
+// The offset is exact if the ping and the pong take as long, so the sample
+// of the lowest delay among the last clockSamples is the estimate.
+const clockSamples = 8
+
+// clockSample is an offset measured by a ping.
+type clockSample struct {
+	offset time.Duration
+	delay  time.Duration
+}
+
+// clockFilter keeps the last samples of a pingu.
+type clockFilter struct {
+	samples [clockSamples]clockSample
+	n, next int
+	// skewed reports whether the offset is past Config.MaxClockSkew.
+	skewed bool
+}
+
+// measureClock returns the clock sample of the pong to the ping sent at t1,
+// false if the pong has no timestamps.
+func measureClock(t1 time.Time, r *pongPacket) (clockSample, bool) {
+	if r.Recv == 0 || r.Sent == 0 || r.recvAt.IsZero() {
+		return clockSample{}, false
+	}
+	t2 := time.UnixMicro(r.Recv)
+	t3 := time.UnixMicro(r.Sent)
+	t4 := r.recvAt
+	s := clockSample{
+		offset: (t2.Sub(t1) + t3.Sub(t4)) / 2,
+		delay:  t4.Sub(t1) - t3.Sub(t2),
+	}
+	if s.delay < 0 {
+		s.delay = 0
+	}
+	return s, true
+}
+
+// best returns the sample of the lowest delay.
+func (f *clockFilter) best() clockSample {
+	b := f.samples[0]
+	for _, s := range f.samples[1:f.n] {
+		if s.delay < b.delay {
+			b = s
+		}
+	}
+	return b
+}
+
+// observeClock records the clock sample of the pingu, and sends
+// EventClockSkewed or EventClockSynced when its offset crosses
+// Config.MaxClockSkew.
+//
+// The caller must hold p.mu.
+func (p *Pingu) observeClock(rawAddr string, st *peer, s clockSample, now time.Time) {
+	if st.clock == nil {
+		st.clock = new(clockFilter)
+	}
+	f := st.clock
+	f.samples[f.next] = s
+	f.next = (f.next + 1) % clockSamples
+	if f.n < clockSamples {
+		f.n++
+	}
+	if p.cfg.MaxClockSkew <= 0 {
+		return
+	}
+	offset := f.best().offset
+	if offset < 0 {
+		offset = -offset
+	}
+	skewed := offset > p.cfg.MaxClockSkew
+	if skewed == f.skewed {
+		return
+	}
+	f.skewed = skewed
+	t := EventClockSynced
+	if skewed {
+		t = EventClockSkewed
+	}
+	p.emit(Event{Type: t, Addr: rawAddr, Time: now})
+}
@@ -0,0 +1,92 @@
+package pingu
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMeasureClock(t *testing.T) {
+	// The pingu is 5s ahead, the ping takes 10ms and the pong 30ms.
+	t1 := time.Now()
+	r := &pongPacket{
+		Recv:   t1.Add(5*time.Second + 10*time.Millisecond).UnixMicro(),
+		Sent:   t1.Add(5*time.Second + 15*time.Millisecond).UnixMicro(),
+		recvAt: t1.Add(45 * time.Millisecond),
+	}
+	s, ok := measureClock(t1, r)
+	if !ok {
+		t.Fatalf("MeasureClock failure")
+	}
+	// The asymmetry of the paths is an error of half the difference.
+	if want := 5*time.Second - 10*time.Millisecond; s.offset.Round(time.Millisecond) != want {
+		t.Fatalf("MeasureClock invalid offset got: %v, want: %v", s.offset, want)
+	}
+	if want := 40 * time.Millisecond; s.delay.Round(time.Millisecond) != want {
+		t.Fatalf("MeasureClock invalid delay got: %v, want: %v", s.delay, want)
+	}
+	if _, ok := measureClock(t1, &pongPacket{recvAt: t1}); ok {
+		t.Fatalf("MeasureClock expected failure without timestamps")
+	}
+}
+
+func TestObserveClock(t *testing.T) {
+	p, err := NewPingu("127.0.0.1:10890", &Config{MaxClockSkew: time.Second})
+	if err != nil {
+		t.Fatalf("Clock NewPingu failure %v", err)
+	}
+	defer p.Close()
+	sub := p.Subscribe(8)
+	defer sub.Unsubscribe()
+
+	addr := "127.0.0.1:10891"
+	p.mu.Lock()
+	st := p.peer(addr)
+	now := time.Now()
+	// The sample of the lowest delay wins over the noisy ones.
+	p.observeClock(addr, st, clockSample{offset: 3 * time.Second, delay: 200 * time.Millisecond}, now)
+	p.observeClock(addr, st, clockSample{offset: 2 * time.Second, delay: time.Millisecond}, now)
+	p.observeClock(addr, st, clockSample{offset: 0, delay: 100 * time.Millisecond}, now)
+	snap := st.snapshot(nil)
+	for i := 0; i < clockSamples; i++ {
+		p.observeClock(addr, st, clockSample{offset: 10 * time.Millisecond, delay: 10 * time.Millisecond}, now)
+	}
+	p.mu.Unlock()
+
+	if snap.ClockOffset != 2*time.Second || snap.ClockDelay != time.Millisecond {
+		t.Fatalf("ObserveClock invalid offset got: %v, delay: %v", snap.ClockOffset, snap.ClockDelay)
+	}
+	var types []EventType
+	for len(sub.Events()) != 0 {
+		types = append(types, (<-sub.Events()).Type)
+	}
+	if len(types) != 2 || types[0] != EventClockSkewed || types[1] != EventClockSynced {
+		t.Fatalf("ObserveClock invalid events got: %v", types)
+	}
+}
+
+func TestPeerStateClock(t *testing.T) {
+	addrs := []string{"127.0.0.1:11790", "127.0.0.1:11791"}
+	p, err := NewPingu(addrs[0], nil)
+	if err != nil {
+		t.Fatalf("Clock NewPingu failure %v", err)
+	}
+	defer p.Close()
+	p.Start()
+	other, err := NewPingu(addrs[1], nil)
+	if err != nil {
+		t.Fatalf("Clock NewPingu failure %v", err)
+	}
+	defer other.Close()
+	other.Start()
+	p.RegisterWithRawAddr(addrs[1])
+	if err := p.StartProbing(ProbeOptions{Interval: 10 * time.Millisecond, Timeout: 10 * time.Millisecond}); err != nil {
+		t.Fatalf("Clock StartProbing failure %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	// Same clock on both sides.
+	st, _ := p.PeerState(addrs[1])
+	if st.ClockDelay <= 0 || st.ClockOffset > 50*time.Millisecond || st.ClockOffset < -50*time.Millisecond {
+		t.Fatalf("PeerState invalid clock got: %v, delay: %v", st.ClockOffset, st.ClockDelay)
+	}
+}
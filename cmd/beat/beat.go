@@ -0,0 +1,27 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/protocol-diver/pingu"
+)
+
+// go run beat.go --status 0 127.0.0.1:4874 nightly-backup
+func main() {
+	statusFlag := flag.Int("status", 0, "exit status of the job")
+	flag.Parse()
+
+	if flag.NArg() != 2 {
+		fmt.Println("usage: beat [--status code] <addr> <check-name>")
+		os.Exit(2)
+	}
+	dest, name := flag.Arg(0), flag.Arg(1)
+
+	if err := pingu.SendBeat(dest, name, *statusFlag); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	fmt.Println("beat sent ip:", dest, "check:", name, "status:", *statusFlag)
+}
@@ -6,14 +6,116 @@
 
 package pingu
 
-const DefultRecvBufferSize = 256
+import "time"
+
+const (
+	DefultRecvBufferSize = 256
+	DefaultBeatGrace     = 2
+	// DefaultMaxPacketSize fits the largest packet without padding.
+	DefaultMaxPacketSize = prefixSize + maxPayloadSize
+)
 
 type Config struct {
 	RecvBufferSize int
 	Verbose        bool
+
+	// MaxPacketSize is the size of the largest packet received, and the
+	// largest size ProbePathMTU tries. Default value : DefaultMaxPacketSize,
+	// also the minimum
+	MaxPacketSize int
+
+	// Gossip piggybacks the peer state updates on the pings and pongs, SWIM
+	// style, and applies the ones received. Pingus learned that way are
+	// registered. So every pingu keeps the full state even if it probes only
+	// a subset of the pingus, see ProbeOptions.Targets.
+	//
+	// A pingu is known to the others by its listen address, it must not
+	// listen on an unspecified address.
+	Gossip bool
+
+	// DeadBackoff is the delay before probing again a dead pingu. It doubles
+	// at each failed probe up to DeadBackoffMax, and is reset by any packet
+	// from the pingu. Zero disables the backoff.
+	DeadBackoff time.Duration
+	// DeadBackoffMax is the ceiling of the backoff, default value : 64 * DeadBackoff
+	DeadBackoffMax time.Duration
+
+	// ReapAfter unregisters a pingu that has been dead for that long, and
+	// sends EventReaped. Zero disables the reaping.
+	ReapAfter time.Duration
+	// TombstoneTTL is the time a reaped pingu is not registered again by
+	// gossip, default value : ReapAfter
+	TombstoneTTL time.Duration
+
+	// A probe sends up to ProbeAttempts pings to a pingu, ProbeSpacing apart,
+	// and the pingu is alive if ProbeQuorum pongs return before the timeout.
+	// So a single lost packet doesn't make it dead. Default values : 1 ping,
+	// 1 pong, timeout / ProbeAttempts
+	ProbeAttempts int
+	ProbeQuorum   int
+	ProbeSpacing  time.Duration
+
+	// PassiveLiveness takes any valid packet from a registered pingu as a
+	// proof of life, not only the pongs to our pings. A pingu that pinged us
+	// within PassiveLiveness is not probed, so for pingus that monitor each
+	// other, the one being pinged skips its probes while the traffic flows.
+	// Zero disables it.
+	PassiveLiveness time.Duration
+
+	// DetectRefused pings through a UDP socket connected to each pingu, so
+	// the ICMP port unreachable of a host up with no pingu listening ends the
+	// probe at once, with ReasonRefused, see PeerState.Reason. The pings are
+	// sent from other ports then, so they are not taken as a proof of life by
+	// the PassiveLiveness of the other pingus.
+	DetectRefused bool
+
+	// BeatGrace is the factor of the declared interval of a Beater after which
+	// a registered pingu that stopped beating is dead, default value : 2
+	BeatGrace float64
+
+	// LeaseMargin covers the clock skew of the lease holder and grantor. The
+	// holder stops relying on a lease LeaseMargin before its expiry, and the
+	// grantor waits LeaseMargin after it. Default value : 1/10 of the lease
+	LeaseMargin time.Duration
+
+	// MaxClockSkew sends EventClockSkewed when the clock offset of a pingu
+	// goes past it, and EventClockSynced when it's back. Zero disables the
+	// events, the offset is still measured, see PeerState.ClockOffset.
+	MaxClockSkew time.Duration
 }
 
 func (c *Config) Default() {
 	c.RecvBufferSize = DefultRecvBufferSize
+	c.MaxPacketSize = DefaultMaxPacketSize
 	c.Verbose = false
 }
+
+// probeAttempts returns the ping count, the pong quorum and the ping spacing
+// of a probe.
+func (c *Config) probeAttempts(timeout time.Duration) (attempts, quorum int, spacing time.Duration) {
+	attempts, quorum, spacing = c.ProbeAttempts, c.ProbeQuorum, c.ProbeSpacing
+	if attempts < 1 {
+		attempts = 1
+	}
+	if quorum < 1 {
+		quorum = 1
+	}
+	if quorum > attempts {
+		quorum = attempts
+	}
+	if spacing <= 0 {
+		spacing = timeout / time.Duration(attempts)
+	}
+	if spacing <= 0 {
+		spacing = time.Millisecond
+	}
+	return
+}
+
+// leaseMargin returns the margin of a lease of duration d.
+func (c *Config) leaseMargin(d time.Duration) time.Duration {
+	if c.LeaseMargin > 0 {
+		return c.LeaseMargin
+	}
+	return d / 10
+}
@@ -12,12 +12,12 @@ func TestConfigDeafult(t *testing.T) {
 
 	defaultBufferSize := DefultRecvBufferSize
 	tdl := []td{
-		{got: Config{RecvBufferSize: 5, Verbose: true}, expect: Config{RecvBufferSize: defaultBufferSize, Verbose: false}},
-		{got: Config{RecvBufferSize: 3, Verbose: false}, expect: Config{RecvBufferSize: defaultBufferSize, Verbose: false}},
-		{got: Config{RecvBufferSize: 80}, expect: Config{RecvBufferSize: defaultBufferSize, Verbose: false}},
-		{got: Config{Verbose: true}, expect: Config{RecvBufferSize: defaultBufferSize, Verbose: false}},
-		{got: Config{Verbose: false}, expect: Config{RecvBufferSize: defaultBufferSize, Verbose: false}},
-		{got: Config{}, expect: Config{RecvBufferSize: defaultBufferSize, Verbose: false}},
+		{got: Config{RecvBufferSize: 5, Verbose: true}, expect: Config{RecvBufferSize: defaultBufferSize, MaxPacketSize: DefaultMaxPacketSize, Verbose: false}},
+		{got: Config{RecvBufferSize: 3, Verbose: false}, expect: Config{RecvBufferSize: defaultBufferSize, MaxPacketSize: DefaultMaxPacketSize, Verbose: false}},
+		{got: Config{RecvBufferSize: 80}, expect: Config{RecvBufferSize: defaultBufferSize, MaxPacketSize: DefaultMaxPacketSize, Verbose: false}},
+		{got: Config{Verbose: true}, expect: Config{RecvBufferSize: defaultBufferSize, MaxPacketSize: DefaultMaxPacketSize, Verbose: false}},
+		{got: Config{Verbose: false}, expect: Config{RecvBufferSize: defaultBufferSize, MaxPacketSize: DefaultMaxPacketSize, Verbose: false}},
+		{got: Config{}, expect: Config{RecvBufferSize: defaultBufferSize, MaxPacketSize: DefaultMaxPacketSize, Verbose: false}},
 	}
 
 	for _, td := range tdl {
@@ -35,5 +35,8 @@ func compare(a Config, b Config) bool {
 	if a.Verbose != b.Verbose {
 		return false
 	}
+	if a.MaxPacketSize != b.MaxPacketSize {
+		return false
+	}
 	return true
 }
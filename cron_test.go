@@ -0,0 +1,73 @@
+package pingu_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/protocol-diver/pingu"
+)
+
+func TestParseCron(t *testing.T) {
+	type td struct {
+		expr   string
+		from   string
+		expect string
+		err    bool
+	}
+	tdl := []td{
+		{expr: "* * * * *", from: "2022-10-19 10:20:30", expect: "2022-10-19 10:21:00"},
+		{expr: "*/15 * * * *", from: "2022-10-19 10:20:30", expect: "2022-10-19 10:30:00"},
+		{expr: "0 2 * * *", from: "2022-10-19 10:20:30", expect: "2022-10-20 02:00:00"},
+		{expr: "30 9 * * 1-5", from: "2022-10-21 10:00:00", expect: "2022-10-24 09:30:00"},
+		{expr: "0 0 1,15 * *", from: "2022-10-19 10:20:30", expect: "2022-11-01 00:00:00"},
+		{expr: "0 0 29 2 *", from: "2022-10-19 10:20:30", expect: "2024-02-29 00:00:00"},
+		{expr: "0 0 29 2 *", from: "2097-01-01 00:00:00", expect: "2104-02-29 00:00:00"},
+		{expr: "0 0 * * 7", from: "2022-10-19 10:20:30", expect: "2022-10-23 00:00:00"},
+		{expr: "0 0 13 * 5", from: "2022-10-19 10:20:30", expect: "2022-10-21 00:00:00"},
+		{expr: "* * * *", err: true},
+		{expr: "60 * * * *", err: true},
+		{expr: "*/0 * * * *", err: true},
+		{expr: "5-1 * * * *", err: true},
+		{expr: "0 0 31 2 *", err: true},
+		{expr: "0 0 30,31 2 *", err: true},
+		{expr: "0 0 31 4,6,9,11 *", err: true},
+	}
+
+	for _, td := range tdl {
+		sched, err := pingu.ParseCron(td.expr)
+		if err != nil {
+			if !td.err {
+				t.Fatalf("ParseCron failure %q got: %v", td.expr, err)
+			}
+			continue
+		}
+		if td.err {
+			t.Fatalf("ParseCron failure: accepted %q", td.expr)
+		}
+		from, _ := time.Parse("2006-01-02 15:04:05", td.from)
+		if got := sched.Next(from).Format("2006-01-02 15:04:05"); got != td.expect {
+			t.Fatalf("ParseCron %q failure got: %v, want: %v", td.expr, got, td.expect)
+		}
+	}
+}
+
+// never is a schedule that never runs.
+type never struct{}
+
+func (never) Next(t time.Time) time.Time { return time.Time{} }
+
+func TestRegisterCheckNever(t *testing.T) {
+	p, err := pingu.NewPingu("127.0.0.1:11390", nil)
+	if err != nil {
+		t.Fatalf("RegisterCheck NewPingu failure %v", err)
+	}
+	defer p.Close()
+	for _, schedule := range []pingu.Schedule{never{}, pingu.Every(0), pingu.Every(-time.Hour)} {
+		if err := p.RegisterCheck("never", schedule, time.Second); err == nil {
+			t.Fatalf("RegisterCheck expected failure on a schedule that never runs: %v", schedule)
+		}
+		if _, ok := p.CheckState("never"); ok {
+			t.Fatalf("RegisterCheck registered a schedule that never runs: %v", schedule)
+		}
+	}
+}
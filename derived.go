@@ -0,0 +1,115 @@
+// Copyright (c) 2022, Seungbae Yu <dbadoy4874@gmail.com>
+// All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package pingu
+
+import (
+	"fmt"
+	"time"
+)
+
+// derived is a check derived from a health expression.
+type derived struct {
+	expr   expr
+	health Health
+}
+
+// SetDerivedCheck sets the check 'name' alive while the health expression
+// holds, replacing the previous one. It's evaluated again whenever the
+// health of a pingu or a group changed.
+//
+// A health expression combines the health of the pingus and the groups:
+//
+//	db-primary && (cache-a || cache-b) && atleast(2, api-*)
+//
+// A name is a group, or else the labels and the raw addresses of the
+// registered pingus it matches, '*' matching any sequence. The brackets of
+// an IPv6 address, like '[::1]:7000', are literal. It's true if the group is
+// alive, or if the pingus it matches are all alive. A name matching nothing
+// is false. atleast(k, ...) is true if at least k of its arguments
+// are, a name counting once per alive pingu it matches. The operators are
+// '!', '&&' and '||', by decreasing precedence.
+func (p *Pingu) SetDerivedCheck(name string, expression string) error {
+	if name == "" {
+		return fmt.Errorf("invalid derived check name: %q", name)
+	}
+	e, err := parseExpr(expression)
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	d, ok := p.derived[name]
+	if !ok {
+		d = &derived{health: Dead}
+		p.derived[name] = d
+	}
+	d.expr = e
+	p.evalDerived()
+	return nil
+}
+
+// RemoveDerivedCheck removes the derived check.
+func (p *Pingu) RemoveDerivedCheck(name string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.derived, name)
+}
+
+// DerivedCheck returns the health of the derived check, false if it's not
+// set.
+func (p *Pingu) DerivedCheck(name string) (Health, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	d, ok := p.derived[name]
+	if !ok {
+		return 0, false
+	}
+	return d.health, true
+}
+
+// DerivedChecks returns the health of the derived checks.
+func (p *Pingu) DerivedChecks() map[string]Health {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	r := make(map[string]Health, len(p.derived))
+	for name, d := range p.derived {
+		r[name] = d.health
+	}
+	return r
+}
+
+// evaluate updates the groups, then the derived checks that may refer to
+// them, after a change of the pingus.
+//
+// The caller must hold p.mu.
+func (p *Pingu) evaluate() {
+	p.evalGroups()
+	p.evalDerived()
+}
+
+// evalDerived updates the health of the derived checks and sends the events
+// of the changed ones.
+//
+// The caller must hold p.mu.
+func (p *Pingu) evalDerived() {
+	now := time.Now()
+	for name, d := range p.derived {
+		h := Dead
+		if d.expr.eval(p) {
+			h = Alive
+		}
+		if h == d.health {
+			continue
+		}
+		d.health = h
+		t := EventDerivedDead
+		if h == Alive {
+			t = EventDerivedAlive
+		}
+		p.emit(Event{Type: t, Name: name, Time: now})
+	}
+}
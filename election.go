@@ -0,0 +1,154 @@
+// Copyright (c) 2022, Seungbae Yu <dbadoy4874@gmail.com>
+// All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package pingu
+
+import (
+	"hash/fnv"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ElectionOptions configures an Election.
+type ElectionOptions struct {
+	// Priorities maps raw addresses to priorities. The alive pingu with the
+	// highest priority leads, the lowest address breaks the ties. A pingu not
+	// in the map has priority 0. All the pingus must use the same map.
+	Priorities map[string]int
+}
+
+// Election picks a leader among this pingu and the registered alive pingus.
+// The pick is deterministic, so the pingus that see the same health agree on
+// the leader without exchanging messages.
+//
+// There is no leader while less than a majority of the pingus is alive, so
+// the leader steps down when it loses contact with the majority.
+//
+// The term of a leader is derived from the leader and the alive pingus, so
+// the pingus that see the same health agree on the term too. A new term
+// starts whenever the leader or the alive pingus change.
+type Election struct {
+	p    *Pingu
+	opts ElectionOptions
+
+	mu     sync.Mutex
+	leader string
+	term   uint64
+
+	cancel chan struct{}
+	once   sync.Once
+}
+
+// StartElection starts an election that follows the health changes. Use
+// Election.Stop to stop it.
+func (p *Pingu) StartElection(opts ElectionOptions) *Election {
+	e := &Election{p: p, opts: opts, cancel: make(chan struct{})}
+	changed := p.watch()
+	e.elect()
+	go e.loop(changed)
+	return e
+}
+
+// Leader returns the raw address of the leader and its term. The address is
+// empty and the term 0 if there is no leader. Compare the terms for
+// equality only, they are not ordered.
+//
+// The pingus agree on the leader only as long as they see the same health,
+// the election can't fence a stale leader. Use a lease for that, see
+// AcquireLease.
+func (e *Election) Leader() (string, uint64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.leader, e.term
+}
+
+// IsLeader reports whether this pingu is the leader.
+func (e *Election) IsLeader() bool {
+	leader, _ := e.Leader()
+	return leader != "" && leader == e.p.self
+}
+
+// Stop stops following the health changes.
+func (e *Election) Stop() {
+	e.once.Do(func() {
+		close(e.cancel)
+	})
+}
+
+func (e *Election) loop(changed chan struct{}) {
+	defer e.p.unwatch(changed)
+	for {
+		select {
+		case <-changed:
+			e.elect()
+		case <-e.cancel:
+			return
+		}
+	}
+}
+
+// elect picks the leader and sends EventLeaderChanged if the leader or its
+// term changed.
+func (e *Election) elect() {
+	e.p.mu.Lock()
+	defer e.p.mu.Unlock()
+
+	total := 1
+	alive := []string{e.p.self}
+	leader := e.p.self
+	for addr := range e.p.wl {
+		if addr == e.p.self {
+			continue
+		}
+		total++
+		if st, ok := e.p.peers[addr]; !ok || st.health != Alive {
+			continue
+		}
+		alive = append(alive, addr)
+		if e.before(addr, leader) {
+			leader = addr
+		}
+	}
+	var term uint64
+	if len(alive)*2 <= total {
+		leader = ""
+	} else {
+		term = electionTerm(leader, alive)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if leader == e.leader && term == e.term {
+		return
+	}
+	e.leader, e.term = leader, term
+	e.p.emit(Event{Type: EventLeaderChanged, Addr: leader, Term: term, Time: time.Now()})
+}
+
+// electionTerm returns the term of leader over the alive pingus, never 0.
+func electionTerm(leader string, alive []string) uint64 {
+	sort.Strings(alive)
+	h := fnv.New64a()
+	h.Write([]byte(leader))
+	for _, addr := range alive {
+		h.Write([]byte{0})
+		h.Write([]byte(addr))
+	}
+	if term := h.Sum64(); term != 0 {
+		return term
+	}
+	return 1
+}
+
+// before reports whether the pingu at a goes before the one at b.
+func (e *Election) before(a, b string) bool {
+	pa, pb := e.opts.Priorities[a], e.opts.Priorities[b]
+	if pa != pb {
+		return pa > pb
+	}
+	return a < b
+}
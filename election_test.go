@@ -0,0 +1,88 @@
+package pingu_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/protocol-diver/pingu"
+)
+
+func TestElection(t *testing.T) {
+	addrs := []string{"127.0.0.1:9990", "127.0.0.1:9991", "127.0.0.1:9992"}
+	pingus := make([]*pingu.Pingu, 0, len(addrs))
+	for _, addr := range addrs {
+		p, err := pingu.NewPingu(addr, nil)
+		if err != nil {
+			t.Fatalf("Election NewPingu failure %v", err)
+		}
+		defer p.Close()
+		p.Start()
+		pingus = append(pingus, p)
+	}
+	opts := pingu.ElectionOptions{Priorities: map[string]int{addrs[1]: 1}}
+	elections := make([]*pingu.Election, 0, len(pingus))
+	for i, p := range pingus {
+		for j, addr := range addrs {
+			if i != j {
+				p.RegisterWithRawAddr(addr)
+			}
+		}
+		err := p.StartProbing(pingu.ProbeOptions{Interval: 10 * time.Millisecond, Timeout: 10 * time.Millisecond})
+		if err != nil {
+			t.Fatalf("Election StartProbing failure %v", err)
+		}
+		e := p.StartElection(opts)
+		defer e.Stop()
+		elections = append(elections, e)
+	}
+	sub := pingus[2].Subscribe(16)
+	defer sub.Unsubscribe()
+
+	time.Sleep(100 * time.Millisecond)
+	_, first := elections[0].Leader()
+	for _, e := range elections {
+		leader, term := e.Leader()
+		if leader != addrs[1] {
+			t.Fatalf("Election invalid leader: %v, want: %v", leader, addrs[1])
+		}
+		// The pingus agree on the term.
+		if term == 0 || term != first {
+			t.Fatalf("Election invalid term: %v, want: %v", term, first)
+		}
+	}
+	if !elections[1].IsLeader() || elections[0].IsLeader() {
+		t.Fatalf("Election invalid IsLeader")
+	}
+
+	// The leader is gone, the next one takes over.
+	pingus[1].Close()
+	time.Sleep(100 * time.Millisecond)
+	leader, term := elections[2].Leader()
+	if leader != addrs[0] {
+		t.Fatalf("Election invalid leader: %v, want: %v", leader, addrs[0])
+	}
+	if term == 0 || term == first {
+		t.Fatalf("Election invalid term: %v, previous: %v", term, first)
+	}
+	if _, other := elections[0].Leader(); other != term {
+		t.Fatalf("Election invalid term: %v, want: %v", other, term)
+	}
+
+	// No majority, no leader.
+	pingus[0].Close()
+	time.Sleep(100 * time.Millisecond)
+	leader, term = elections[2].Leader()
+	if leader != "" || term != 0 {
+		t.Fatalf("Election invalid leader: %v, term: %v, want: none", leader, term)
+	}
+
+	var last pingu.Event
+	for len(sub.Events()) != 0 {
+		if e := <-sub.Events(); e.Type == pingu.EventLeaderChanged {
+			last = e
+		}
+	}
+	if last.Type != pingu.EventLeaderChanged || last.Addr != "" || last.Term != 0 {
+		t.Fatalf("Election invalid event: %+v", last)
+	}
+}
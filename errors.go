@@ -0,0 +1,74 @@
+// Copyright (c) 2022, Seungbae Yu <dbadoy4874@gmail.com>
+// All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package pingu
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+)
+
+var (
+	// ErrTimeout is a ping not answered in time.
+	ErrTimeout = errors.New("timed out")
+	// ErrRefused is a ping refused by the host, see Config.DetectRefused.
+	ErrRefused = errors.New("connection refused")
+	// ErrNotRunning is a request on a Pingu not started, see Start.
+	ErrNotRunning = errors.New("pingu not running")
+	// ErrAuthFailed is a packet that failed the authentication. The packets
+	// are not authenticated yet, so no function returns it.
+	ErrAuthFailed = errors.New("authentication failed")
+	// ErrSendFailed is a packet that couldn't be sent, see SendError.
+	ErrSendFailed = errors.New("send failed")
+)
+
+// SendError is a packet that couldn't be sent to Addr. It wraps the net
+// error, or the encoding error of a packet too large, and is ErrSendFailed.
+type SendError struct {
+	Addr string
+	Err  error
+}
+
+func (e *SendError) Error() string {
+	return fmt.Sprintf("send failed ip: %v: %v", e.Addr, e.Err)
+}
+
+func (e *SendError) Unwrap() error { return e.Err }
+
+func (e *SendError) Is(target error) bool { return target == ErrSendFailed }
+
+// sendError wraps the error of a send on conn to addr, its remote address if
+// addr is nil.
+func sendError(conn *net.UDPConn, addr *net.UDPAddr, err error) error {
+	raw := ""
+	if addr != nil {
+		raw = addr.String()
+	} else if remote := conn.RemoteAddr(); remote != nil {
+		raw = remote.String()
+	}
+	return &SendError{Addr: raw, Err: err}
+}
+
+// logSendError logs the error of a send nobody waits for, if verbose.
+func (p *Pingu) logSendError(err error) {
+	if p.cfg.Verbose {
+		log.Printf("[pingu] %v\n", err)
+	}
+}
+
+// failure returns the reason and the error of a failed probe.
+func (r *probeResult) failure() (Reason, error) {
+	switch {
+	case r.refused:
+		return ReasonRefused, ErrRefused
+	case r.sendErr != nil:
+		return ReasonSendFailed, r.sendErr
+	default:
+		return ReasonTimeout, ErrTimeout
+	}
+}
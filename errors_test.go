@@ -0,0 +1,66 @@
+package pingu_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/protocol-diver/pingu"
+)
+
+func TestErrors(t *testing.T) {
+	p, err := pingu.NewPingu("127.0.0.1:11290", &pingu.Config{DetectRefused: true})
+	if err != nil {
+		t.Fatalf("Errors NewPingu failure %v", err)
+	}
+	defer p.Close()
+	q, err := pingu.NewPingu("127.0.0.1:11291", nil)
+	if err != nil {
+		t.Fatalf("Errors NewPingu failure %v", err)
+	}
+	defer q.Close()
+
+	if err := p.PingPongWithRawAddr("127.0.0.1:11292", 10*time.Millisecond); !errors.Is(err, pingu.ErrNotRunning) {
+		t.Fatalf("PingPong failure got: %v, want: %v", err, pingu.ErrNotRunning)
+	}
+	p.Start()
+	q.Start()
+
+	if err := p.PingPongWithRawAddr("127.0.0.1:11292", time.Second); !errors.Is(err, pingu.ErrRefused) {
+		t.Fatalf("PingPong failure got: %v, want: %v", err, pingu.ErrRefused)
+	}
+	if err := q.PingPongWithRawAddr("127.0.0.1:11292", 10*time.Millisecond); !errors.Is(err, pingu.ErrTimeout) {
+		t.Fatalf("PingPong failure got: %v, want: %v", err, pingu.ErrTimeout)
+	}
+
+	// An IPv4 socket can't send to an IPv6 address.
+	err = q.PingPongWithRawAddr("[::1]:11292", 10*time.Millisecond)
+	var serr *pingu.SendError
+	if !errors.Is(err, pingu.ErrSendFailed) || !errors.As(err, &serr) || serr.Addr != "[::1]:11292" {
+		t.Fatalf("PingPong failure got: %v, want: %v", err, pingu.ErrSendFailed)
+	}
+	var nerr *net.OpError
+	if !errors.As(err, &nerr) {
+		t.Fatalf("PingPong failure got: %T, want: %T", errors.Unwrap(serr), nerr)
+	}
+
+	r, err := q.Burst(context.Background(), "[::1]:11292", 2, 0)
+	if err != nil || r.Received != 0 || !errors.Is(r.LastError, pingu.ErrSendFailed) {
+		t.Fatalf("Burst invalid error got: %v, %v, want: %v", err, r.LastError, pingu.ErrSendFailed)
+	}
+
+	q.RegisterWithRawAddr("[::1]:11292")
+	q.RegisterWithRawAddr("127.0.0.1:11292")
+	if err := q.StartProbing(pingu.ProbeOptions{Interval: 10 * time.Millisecond, Timeout: 10 * time.Millisecond}); err != nil {
+		t.Fatalf("Errors StartProbing failure %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if st, _ := q.PeerState("[::1]:11292"); st.Reason != pingu.ReasonSendFailed || !errors.Is(st.LastError, pingu.ErrSendFailed) {
+		t.Fatalf("PeerState invalid reason got: %v, %v, want: %v", st.Reason, st.LastError, pingu.ReasonSendFailed)
+	}
+	if st, _ := q.PeerState("127.0.0.1:11292"); st.Reason != pingu.ReasonTimeout || !errors.Is(st.LastError, pingu.ErrTimeout) {
+		t.Fatalf("PeerState invalid reason got: %v, %v, want: %v", st.Reason, st.LastError, pingu.ReasonTimeout)
+	}
+}
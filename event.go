@@ -0,0 +1,219 @@
+// Copyright (c) 2022, Seungbae Yu <dbadoy4874@gmail.com>
+// All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package pingu
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// EventType is the type of an Event.
+type EventType uint8
+
+const (
+	// EventAlive is sent when a pingu became alive.
+	EventAlive EventType = 1 + iota
+	// EventDead is sent when a pingu became dead.
+	EventDead
+	// EventReaped is sent when a long-dead pingu is unregistered, see
+	// Config.ReapAfter.
+	EventReaped
+
+	// EventCheckUp, EventCheckFailed, EventCheckLate and EventCheckMissing
+	// are sent when the status of a check changed, see RegisterCheck.
+	EventCheckUp
+	EventCheckFailed
+	EventCheckLate
+	EventCheckMissing
+
+	// EventLeaseGranted is sent when a lease is granted to a new holder,
+	// EventLeaseReleased when the holder released it, see GrantLease.
+	EventLeaseGranted
+	EventLeaseReleased
+	// EventLeaseExpired is sent by the grantor and the holder when a lease
+	// expired.
+	EventLeaseExpired
+
+	// EventLeaderChanged is sent when the leader of an Election or its term
+	// changed.
+	EventLeaderChanged
+
+	// EventOwnershipMoved is sent when a pingu gained or lost keys of a Ring.
+	EventOwnershipMoved
+
+	// EventBreakerOpened, EventBreakerHalfOpen and EventBreakerClosed are
+	// sent when the state of a circuit breaker changed, see NewBreakers.
+	EventBreakerOpened
+	EventBreakerHalfOpen
+	EventBreakerClosed
+
+	// EventGroupAlive and EventGroupDead are sent when the health of a group
+	// changed, see SetGroup.
+	EventGroupAlive
+	EventGroupDead
+
+	// EventDerivedAlive and EventDerivedDead are sent when the health of a
+	// derived check changed, see SetDerivedCheck.
+	EventDerivedAlive
+	EventDerivedDead
+
+	// EventLatencyNormal, EventLatencyWarning and EventLatencyCritical are
+	// sent when the latency level of an alive pingu changed, see
+	// SetLatencyThresholds.
+	EventLatencyNormal
+	EventLatencyWarning
+	EventLatencyCritical
+
+	// EventClockSkewed is sent when the clock offset of a pingu went past
+	// Config.MaxClockSkew, EventClockSynced when it's back under.
+	EventClockSkewed
+	EventClockSynced
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventAlive:
+		return "alive"
+	case EventDead:
+		return "dead"
+	case EventReaped:
+		return "reaped"
+	case EventCheckUp:
+		return "check up"
+	case EventCheckFailed:
+		return "check failed"
+	case EventCheckLate:
+		return "check late"
+	case EventCheckMissing:
+		return "check missing"
+	case EventLeaseGranted:
+		return "lease granted"
+	case EventLeaseReleased:
+		return "lease released"
+	case EventLeaseExpired:
+		return "lease expired"
+	case EventLeaderChanged:
+		return "leader changed"
+	case EventOwnershipMoved:
+		return "ownership moved"
+	case EventBreakerOpened:
+		return "breaker opened"
+	case EventBreakerHalfOpen:
+		return "breaker half-open"
+	case EventBreakerClosed:
+		return "breaker closed"
+	case EventGroupAlive:
+		return "group alive"
+	case EventGroupDead:
+		return "group dead"
+	case EventDerivedAlive:
+		return "derived alive"
+	case EventDerivedDead:
+		return "derived dead"
+	case EventLatencyNormal:
+		return "latency normal"
+	case EventLatencyWarning:
+		return "latency warning"
+	case EventLatencyCritical:
+		return "latency critical"
+	case EventClockSkewed:
+		return "clock skewed"
+	case EventClockSynced:
+		return "clock synced"
+	default:
+		return fmt.Sprintf("event(%d)", t)
+	}
+}
+
+// Event is a change of the peer state.
+type Event struct {
+	Type EventType
+	Addr string
+	// Name is the name of the check, the lease, the group or the derived
+	// check.
+	Name string
+	// Term is the term of the leader.
+	Term uint64
+	Time time.Time
+}
+
+// Subscription receives the events of a Pingu.
+type Subscription struct {
+	p  *Pingu
+	ch chan Event
+}
+
+// Subscribe returns a subscription to the events buffered with 'size'.
+// If the buffer is full, the events are dropped instead of blocking Pingu.
+func (p *Pingu) Subscribe(size int) *Subscription {
+	s := &Subscription{p: p, ch: make(chan Event, size)}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.subs[s] = struct{}{}
+	return s
+}
+
+// Events returns the channel of the events. It's closed by Unsubscribe.
+func (s *Subscription) Events() <-chan Event {
+	return s.ch
+}
+
+// Unsubscribe stops the delivery of the events and closes the channel.
+func (s *Subscription) Unsubscribe() {
+	s.p.mu.Lock()
+	defer s.p.mu.Unlock()
+	if _, ok := s.p.subs[s]; !ok {
+		return
+	}
+	delete(s.p.subs, s)
+	close(s.ch)
+}
+
+// emit sends the event to the subscriptions.
+//
+// The caller must hold p.mu.
+func (p *Pingu) emit(e Event) {
+	p.notify()
+	for s := range p.subs {
+		select {
+		case s.ch <- e:
+		default:
+			if p.cfg.Verbose {
+				log.Printf("[pingu] dropped event %v %v%v\n", e.Type, e.Addr, e.Name)
+			}
+		}
+	}
+}
+
+// watch returns a channel signaled on any change of the state. The signals
+// are coalesced, never dropped, for the helpers that read the state again.
+func (p *Pingu) watch() chan struct{} {
+	ch := make(chan struct{}, 1)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.watchers[ch] = struct{}{}
+	return ch
+}
+
+func (p *Pingu) unwatch(ch chan struct{}) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.watchers, ch)
+}
+
+// notify signals the watchers.
+//
+// The caller must hold p.mu.
+func (p *Pingu) notify() {
+	for ch := range p.watchers {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package pingu_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/protocol-diver/pingu"
+)
+
+func TestReap(t *testing.T) {
+	cfg := new(pingu.Config)
+	cfg.Default()
+	cfg.ReapAfter = 50 * time.Millisecond
+	cfg.TombstoneTTL = time.Second
+	pingu1, err := pingu.NewPingu("127.0.0.1:9590", cfg)
+	if err != nil {
+		t.Fatalf("Reap NewPingu failure %v", err)
+	}
+	defer pingu1.Close()
+	pingu2, err := pingu.NewPingu("127.0.0.1:9591", nil)
+	if err != nil {
+		t.Fatalf("Reap NewPingu failure %v", err)
+	}
+	defer pingu2.Close()
+	pingu1.Start()
+	pingu2.Start()
+
+	sub := pingu1.Subscribe(16)
+	defer sub.Unsubscribe()
+
+	pingu1.RegisterWithRawAddr("127.0.0.1:9591")
+	pingu1.RegisterWithRawAddr("127.0.0.1:9592")
+	err = pingu1.StartProbing(pingu.ProbeOptions{Interval: 10 * time.Millisecond, Timeout: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("Reap StartProbing failure %v", err)
+	}
+
+	want := map[pingu.EventType]string{
+		pingu.EventAlive:  "127.0.0.1:9591",
+		pingu.EventDead:   "127.0.0.1:9592",
+		pingu.EventReaped: "127.0.0.1:9592",
+	}
+	timeout := time.After(time.Second)
+	for len(want) != 0 {
+		select {
+		case e := <-sub.Events():
+			if addr, ok := want[e.Type]; ok {
+				if addr != e.Addr {
+					t.Fatalf("Reap invalid event: %v %v, want: %v", e.Type, e.Addr, addr)
+				}
+				delete(want, e.Type)
+			}
+		case <-timeout:
+			t.Fatalf("Reap missing events: %v", want)
+		}
+	}
+
+	if pingus := pingu1.Pingus(); len(pingus) != 1 || pingus[0] != "127.0.0.1:9591" {
+		t.Fatalf("Reap invalid pingus: %v", pingus)
+	}
+	if _, ok := pingu1.Tombstones()["127.0.0.1:9592"]; !ok {
+		t.Fatalf("Reap invalid tombstones: %v", pingu1.Tombstones())
+	}
+
+	// Register explicitly clears the tombstone.
+	pingu1.RegisterWithRawAddr("127.0.0.1:9592")
+	if len(pingu1.Tombstones()) != 0 {
+		t.Fatalf("Reap invalid tombstones: %v", pingu1.Tombstones())
+	}
+}
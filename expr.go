@@ -0,0 +1,257 @@
+// Copyright (c) 2022, Seungbae Yu <dbadoy4874@gmail.com>
+// All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package pingu
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// expr is a parsed health expression, see SetDerivedCheck.
+type expr interface {
+	// eval evaluates the expression. The caller must hold p.mu.
+	eval(p *Pingu) bool
+}
+
+type (
+	nameExpr    string
+	notExpr     struct{ x expr }
+	andExpr     struct{ x, y expr }
+	orExpr      struct{ x, y expr }
+	atLeastExpr struct {
+		k    int
+		args []expr
+	}
+)
+
+func (e nameExpr) eval(p *Pingu) bool {
+	if g, ok := p.groups[string(e)]; ok {
+		return g.health == Alive
+	}
+	alive, total := e.count(p)
+	return total > 0 && alive == total
+}
+
+// count returns the number of the pingus matching the name, and the alive
+// ones.
+//
+// The caller must hold p.mu.
+func (e nameExpr) count(p *Pingu) (alive, total int) {
+	for addr := range p.wl {
+		if !e.match(addr, p.labels[addr]) {
+			continue
+		}
+		total++
+		if st, ok := p.peers[addr]; ok && st.health == Alive {
+			alive++
+		}
+	}
+	return alive, total
+}
+
+func (e nameExpr) match(addr string, labels []string) bool {
+	if string(e) == addr {
+		return true
+	}
+	if ok, _ := path.Match(e.pattern(), addr); ok {
+		return true
+	}
+	for _, l := range labels {
+		if string(e) == l {
+			return true
+		}
+		if ok, _ := path.Match(e.pattern(), l); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// pattern returns the glob of the name. The brackets of an IPv6 host, like
+// '[::1]:7000', are literal, not a character class.
+func (e nameExpr) pattern() string {
+	s := string(e)
+	if i := strings.IndexByte(s, ']'); strings.HasPrefix(s, "[") && i > 0 && strings.Contains(s[1:i], ":") {
+		return `\[` + s[1:i] + `\]` + s[i+1:]
+	}
+	return s
+}
+
+func (e notExpr) eval(p *Pingu) bool { return !e.x.eval(p) }
+func (e andExpr) eval(p *Pingu) bool { return e.x.eval(p) && e.y.eval(p) }
+func (e orExpr) eval(p *Pingu) bool  { return e.x.eval(p) || e.y.eval(p) }
+
+func (e atLeastExpr) eval(p *Pingu) bool {
+	n := 0
+	for _, arg := range e.args {
+		if name, ok := arg.(nameExpr); ok {
+			if _, group := p.groups[string(name)]; !group {
+				alive, _ := name.count(p)
+				n += alive
+				continue
+			}
+		}
+		if arg.eval(p) {
+			n++
+		}
+	}
+	return n >= e.k
+}
+
+// parseExpr parses a health expression.
+func parseExpr(s string) (expr, error) {
+	ps := &exprParser{src: s}
+	ps.next()
+	e, err := ps.or()
+	if err != nil {
+		return nil, err
+	}
+	if ps.tok != "" {
+		return nil, ps.errorf()
+	}
+	return e, nil
+}
+
+type exprParser struct {
+	src string
+	// tok is the current token starting at pos, empty at the end.
+	tok string
+	pos int
+	end int
+}
+
+func (ps *exprParser) errorf() error {
+	if ps.tok == "" {
+		return fmt.Errorf("invalid health expression %q: unexpected end", ps.src)
+	}
+	return fmt.Errorf("invalid health expression %q: unexpected %q at %d", ps.src, ps.tok, ps.pos)
+}
+
+func isNameByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+		strings.IndexByte("-_.:*?[]", c) >= 0
+}
+
+// next moves to the next token.
+func (ps *exprParser) next() {
+	i := ps.end
+	for i < len(ps.src) && (ps.src[i] == ' ' || ps.src[i] == '\t' || ps.src[i] == '\n') {
+		i++
+	}
+	ps.pos = i
+	switch {
+	case i == len(ps.src):
+		ps.end = i
+	case strings.HasPrefix(ps.src[i:], "&&"), strings.HasPrefix(ps.src[i:], "||"):
+		ps.end = i + 2
+	case isNameByte(ps.src[i]):
+		ps.end = i + 1
+		for ps.end < len(ps.src) && isNameByte(ps.src[ps.end]) {
+			ps.end++
+		}
+	default:
+		ps.end = i + 1
+	}
+	ps.tok = ps.src[ps.pos:ps.end]
+}
+
+func (ps *exprParser) expect(tok string) error {
+	if ps.tok != tok {
+		return ps.errorf()
+	}
+	ps.next()
+	return nil
+}
+
+func (ps *exprParser) or() (expr, error) {
+	x, err := ps.and()
+	if err != nil {
+		return nil, err
+	}
+	for ps.tok == "||" {
+		ps.next()
+		y, err := ps.and()
+		if err != nil {
+			return nil, err
+		}
+		x = orExpr{x, y}
+	}
+	return x, nil
+}
+
+func (ps *exprParser) and() (expr, error) {
+	x, err := ps.unary()
+	if err != nil {
+		return nil, err
+	}
+	for ps.tok == "&&" {
+		ps.next()
+		y, err := ps.unary()
+		if err != nil {
+			return nil, err
+		}
+		x = andExpr{x, y}
+	}
+	return x, nil
+}
+
+func (ps *exprParser) unary() (expr, error) {
+	switch {
+	case ps.tok == "!":
+		ps.next()
+		x, err := ps.unary()
+		if err != nil {
+			return nil, err
+		}
+		return notExpr{x}, nil
+	case ps.tok == "(":
+		ps.next()
+		x, err := ps.or()
+		if err != nil {
+			return nil, err
+		}
+		return x, ps.expect(")")
+	case ps.tok == "atleast" && strings.HasPrefix(strings.TrimLeft(ps.src[ps.end:], " \t\n"), "("):
+		return ps.atLeast()
+	case ps.tok != "" && isNameByte(ps.tok[0]):
+		name := nameExpr(ps.tok)
+		if _, err := path.Match(name.pattern(), ""); err != nil {
+			return nil, ps.errorf()
+		}
+		ps.next()
+		return name, nil
+	default:
+		return nil, ps.errorf()
+	}
+}
+
+func (ps *exprParser) atLeast() (expr, error) {
+	ps.next()
+	if err := ps.expect("("); err != nil {
+		return nil, err
+	}
+	k, err := strconv.Atoi(ps.tok)
+	if err != nil || k < 0 {
+		return nil, ps.errorf()
+	}
+	ps.next()
+	e := atLeastExpr{k: k}
+	for ps.tok == "," {
+		ps.next()
+		arg, err := ps.or()
+		if err != nil {
+			return nil, err
+		}
+		e.args = append(e.args, arg)
+	}
+	if len(e.args) == 0 {
+		return nil, ps.errorf()
+	}
+	return e, ps.expect(")")
+}
@@ -0,0 +1,224 @@
+package pingu_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/protocol-diver/pingu"
+)
+
+func TestParseExprFailure(t *testing.T) {
+	p, err := pingu.NewPingu("127.0.0.1:10590", nil)
+	if err != nil {
+		t.Fatalf("Expr NewPingu failure %v", err)
+	}
+	defer p.Close()
+	for _, expr := range []string{
+		"",
+		"a &&",
+		"(a || b",
+		"a b",
+		"a & b",
+		"atleast(2)",
+		"atleast(x, a)",
+		"atleast(2, a",
+		"!",
+		"a[",
+	} {
+		if err := p.SetDerivedCheck("check", expr); err == nil {
+			t.Fatalf("SetDerivedCheck expected failure on %q", expr)
+		}
+	}
+	if err := p.SetDerivedCheck("check", "!(a || b) && atleast(1, c, d && e)"); err != nil {
+		t.Fatalf("SetDerivedCheck failure %v", err)
+	}
+}
+
+func TestDerivedCheck(t *testing.T) {
+	addrs := []string{
+		"127.0.0.1:10591",
+		"127.0.0.1:10592", // db-primary
+		"127.0.0.1:10593", // cache-a, down
+		"127.0.0.1:10594", // cache-b
+		"127.0.0.1:10595", // api-1
+		"127.0.0.1:10596", // api-2
+		"127.0.0.1:10597", // api-3, down
+	}
+	labels := []string{"", "db-primary", "cache-a", "cache-b", "api-1", "api-2", "api-3"}
+	p, err := pingu.NewPingu(addrs[0], nil)
+	if err != nil {
+		t.Fatalf("Derived NewPingu failure %v", err)
+	}
+	defer p.Close()
+	p.Start()
+	others := make(map[string]*pingu.Pingu)
+	for i, addr := range addrs[1:] {
+		p.RegisterWithRawAddr(addr)
+		p.SetLabels(addr, labels[i+1])
+		if addr == addrs[2] || addr == addrs[6] {
+			continue
+		}
+		other, err := pingu.NewPingu(addr, nil)
+		if err != nil {
+			t.Fatalf("Derived NewPingu failure %v", err)
+		}
+		defer other.Close()
+		other.Start()
+		others[addr] = other
+	}
+
+	checks := map[string]string{
+		"service": "db-primary && (cache-a || cache-b) && atleast(2, api-*)",
+		"caches":  "cache-*",
+		"apis":    "atleast(3, api-*)",
+		"no-db":   "!db-primary",
+		"by-addr": "127.0.0.1:10594",
+		"unknown": "nothing",
+	}
+	for name, expr := range checks {
+		if err := p.SetDerivedCheck(name, expr); err != nil {
+			t.Fatalf("SetDerivedCheck failure %v", err)
+		}
+	}
+	sub := p.Subscribe(32)
+	defer sub.Unsubscribe()
+	if err := p.StartProbing(pingu.ProbeOptions{Interval: 10 * time.Millisecond, Timeout: 10 * time.Millisecond}); err != nil {
+		t.Fatalf("Derived StartProbing failure %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	want := map[string]pingu.Health{
+		"service": pingu.Alive,
+		"caches":  pingu.Dead,
+		"apis":    pingu.Dead,
+		"no-db":   pingu.Dead,
+		"by-addr": pingu.Alive,
+		"unknown": pingu.Dead,
+	}
+	got := p.DerivedChecks()
+	for name, h := range want {
+		if got[name] != h {
+			t.Fatalf("DerivedChecks %s invalid got: %v, want: %v", name, got[name], h)
+		}
+	}
+	if st, _ := p.PeerState(addrs[1]); len(st.Labels) != 1 || st.Labels[0] != "db-primary" {
+		t.Fatalf("PeerState invalid labels got: %v", st.Labels)
+	}
+
+	// A group is referred by its name.
+	p.SetGroup("api", pingu.AtLeast(2), addrs[4:]...)
+	p.SetDerivedCheck("group", "api && !cache-a")
+	if h, _ := p.DerivedCheck("group"); h != pingu.Alive {
+		t.Fatalf("DerivedCheck invalid got: %v, want: %v", h, pingu.Alive)
+	}
+
+	others[addrs[1]].Close()
+	time.Sleep(100 * time.Millisecond)
+	if h, _ := p.DerivedCheck("service"); h != pingu.Dead {
+		t.Fatalf("DerivedCheck invalid got: %v, want: %v", h, pingu.Dead)
+	}
+
+	var events []pingu.Event
+	for len(sub.Events()) != 0 {
+		if e := <-sub.Events(); e.Name == "service" {
+			events = append(events, e)
+		}
+	}
+	if len(events) != 2 || events[0].Type != pingu.EventDerivedAlive || events[1].Type != pingu.EventDerivedDead {
+		t.Fatalf("DerivedCheck invalid events got: %v", events)
+	}
+
+	p.RemoveDerivedCheck("service")
+	if _, ok := p.DerivedCheck("service"); ok {
+		t.Fatalf("DerivedCheck of removed check")
+	}
+}
+
+func TestDerivedCheckIPv6(t *testing.T) {
+	addrs := []string{"[::1]:11990", "[::1]:11991", "[::1]:11992"}
+	p, err := pingu.NewPingu(addrs[0], nil)
+	if err != nil {
+		t.Fatalf("Derived NewPingu failure %v", err)
+	}
+	defer p.Close()
+	p.Start()
+	other, err := pingu.NewPingu(addrs[1], nil)
+	if err != nil {
+		t.Fatalf("Derived NewPingu failure %v", err)
+	}
+	defer other.Close()
+	other.Start()
+	// addrs[2] is down.
+	p.RegisterWithRawAddr(addrs[1])
+	p.RegisterWithRawAddr(addrs[2])
+
+	checks := map[string]string{
+		"up":      "[::1]:11991",
+		"down":    "[::1]:11992",
+		"all":     "[::1]:*",
+		"atleast": "atleast(1, [::1]:*)",
+	}
+	for name, expr := range checks {
+		if err := p.SetDerivedCheck(name, expr); err != nil {
+			t.Fatalf("SetDerivedCheck failure %v", err)
+		}
+	}
+	if err := p.StartProbing(pingu.ProbeOptions{Interval: 10 * time.Millisecond, Timeout: 10 * time.Millisecond}); err != nil {
+		t.Fatalf("Derived StartProbing failure %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	want := map[string]pingu.Health{
+		"up":      pingu.Alive,
+		"down":    pingu.Dead,
+		"all":     pingu.Dead,
+		"atleast": pingu.Alive,
+	}
+	got := p.DerivedChecks()
+	for name, h := range want {
+		if got[name] != h {
+			t.Fatalf("DerivedChecks %s invalid got: %v, want: %v", name, got[name], h)
+		}
+	}
+}
+
+func TestDerivedCheckReaped(t *testing.T) {
+	addrs := []string{"127.0.0.1:12190", "127.0.0.1:12191", "127.0.0.1:12192"}
+	p, err := pingu.NewPingu(addrs[0], &pingu.Config{ReapAfter: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("Derived NewPingu failure %v", err)
+	}
+	defer p.Close()
+	p.Start()
+	other, err := pingu.NewPingu(addrs[1], nil)
+	if err != nil {
+		t.Fatalf("Derived NewPingu failure %v", err)
+	}
+	defer other.Close()
+	other.Start()
+	// The second web is down.
+	for i, addr := range addrs[1:] {
+		p.RegisterWithRawAddr(addr)
+		p.SetLabels(addr, fmt.Sprintf("web-%d", i+1))
+	}
+	if err := p.SetDerivedCheck("web", "web-*"); err != nil {
+		t.Fatalf("SetDerivedCheck failure %v", err)
+	}
+	if err := p.StartProbing(pingu.ProbeOptions{Interval: 10 * time.Millisecond, Timeout: 10 * time.Millisecond}); err != nil {
+		t.Fatalf("Derived StartProbing failure %v", err)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if h, _ := p.DerivedCheck("web"); h != pingu.Dead {
+		t.Fatalf("DerivedCheck invalid got: %v, want: %v", h, pingu.Dead)
+	}
+
+	// Reaped, the down web no longer counts.
+	time.Sleep(200 * time.Millisecond)
+	if _, ok := p.PeerState(addrs[2]); ok {
+		t.Fatalf("PeerState of reaped pingu")
+	}
+	if h, _ := p.DerivedCheck("web"); h != pingu.Alive {
+		t.Fatalf("DerivedCheck invalid got: %v, want: %v", h, pingu.Alive)
+	}
+}
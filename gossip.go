@@ -0,0 +1,149 @@
+// Copyright (c) 2022, Seungbae Yu <dbadoy4874@gmail.com>
+// All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package pingu
+
+import (
+	"encoding/json"
+	"math"
+	"net"
+	"net/netip"
+	"sort"
+)
+
+// A rumor is piggybacked retransmitMult * log10(N) times, N is the number
+// of the registered pingus.
+const retransmitMult = 4
+
+// update is a peer state piggybacked on the packets.
+type update struct {
+	Addr        string `json:"a"`
+	Health      Health `json:"h"`
+	Incarnation uint32 `json:"n"`
+}
+
+// rumor is an update waiting to be piggybacked.
+type rumor struct {
+	update
+	transmits int
+}
+
+// rumor queues the state of the pingu to spread.
+//
+// The caller must hold p.mu.
+func (p *Pingu) rumor(rawAddr string, st *peer) {
+	if !p.cfg.Gossip {
+		return
+	}
+	p.rumors[rawAddr] = &rumor{update: update{Addr: rawAddr, Health: st.health, Incarnation: st.incarnation}}
+}
+
+// send sends the packet to addr with our coordinate, piggybacking the rumors
+// if enabled.
+func (p *Pingu) send(addr *net.UDPAddr, pkt packet) (int, error) {
+	return p.sendOn(p.conn, addr, pkt)
+}
+
+// sendOn sends the packet as send does, on conn, to its remote address if
+// addr is nil, see Config.DetectRefused.
+func (p *Pingu) sendOn(conn *net.UDPConn, addr *net.UDPAddr, pkt packet) (int, error) {
+	p.stamp(pkt)
+	if p.cfg.Gossip {
+		p.piggyback(pkt)
+	}
+	return sendPacket(conn, addr, pkt)
+}
+
+// piggyback attaches the least transmitted rumors that fit in the packet.
+func (p *Pingu) piggyback(pkt packet) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	h := pkt.Header()
+	h.Incarnation = p.incarnation
+	if len(p.rumors) == 0 {
+		return
+	}
+	rumors := make([]*rumor, 0, len(p.rumors))
+	for _, r := range p.rumors {
+		rumors = append(rumors, r)
+	}
+	sort.Slice(rumors, func(i, j int) bool {
+		return rumors[i].transmits < rumors[j].transmits
+	})
+
+	limit := retransmitMult * int(math.Ceil(math.Log10(float64(len(p.wl)+2))))
+	for _, r := range rumors {
+		h.Gossip = append(h.Gossip, r.update)
+		if b, err := json.Marshal(pkt); err != nil || len(b) > maxPayloadSize {
+			h.Gossip = h.Gossip[:len(h.Gossip)-1]
+			return
+		}
+		r.transmits++
+		if r.transmits >= limit {
+			delete(p.rumors, r.Addr)
+		}
+	}
+}
+
+// merge applies the rumors piggybacked on the packet.
+func (p *Pingu) merge(pkt packet) {
+	h := pkt.Header()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if pkt.Kind() == pong {
+		// The pong is going to mark the sender alive, with its own incarnation.
+		if st, ok := p.peers[pkt.Sender().String()]; ok && h.Incarnation > st.incarnation {
+			st.incarnation = h.Incarnation
+		}
+	}
+	for _, u := range h.Gossip {
+		p.apply(u)
+	}
+}
+
+// apply applies a rumor if it's newer than the known state. The rumor of an
+// unknown alive pingu registers it.
+//
+// The caller must hold p.mu.
+func (p *Pingu) apply(u update) {
+	if u.Health != Alive && u.Health != Dead {
+		return
+	}
+	if u.Addr == p.self {
+		// Refute the rumor of our death by a newer incarnation.
+		if u.Health == Dead && u.Incarnation >= p.incarnation {
+			p.incarnation = u.Incarnation + 1
+			p.rumors[p.self] = &rumor{update: update{Addr: p.self, Health: Alive, Incarnation: p.incarnation}}
+		}
+		return
+	}
+	if _, err := netip.ParseAddrPort(u.Addr); err != nil {
+		return
+	}
+	if !p.wl[u.Addr] {
+		if u.Health != Alive || p.buried(u.Addr) {
+			return
+		}
+		p.wl[u.Addr] = true
+	}
+	if st, ok := p.peers[u.Addr]; ok && !supersedes(u, st) {
+		return
+	}
+	st := p.peer(u.Addr)
+	st.incarnation = u.Incarnation
+	if !p.setHealth(u.Addr, u.Health) {
+		p.rumor(u.Addr, st)
+	}
+}
+
+// supersedes reports whether the update is newer than the state. A newer
+// incarnation wins, and dead wins over alive in the same incarnation.
+func supersedes(u update, st *peer) bool {
+	if u.Incarnation != st.incarnation {
+		return u.Incarnation > st.incarnation
+	}
+	return u.Health == Dead && st.health != Dead
+}
@@ -0,0 +1,80 @@
+package pingu_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/protocol-diver/pingu"
+)
+
+func TestGossip(t *testing.T) {
+	cfg := func() *pingu.Config {
+		cfg := new(pingu.Config)
+		cfg.Default()
+		cfg.Gossip = true
+		return cfg
+	}
+	addrs := []string{"127.0.0.1:9390", "127.0.0.1:9391", "127.0.0.1:9392"}
+	pingus := make([]*pingu.Pingu, 0, len(addrs))
+	for _, addr := range addrs {
+		p, err := pingu.NewPingu(addr, cfg())
+		if err != nil {
+			t.Fatalf("Gossip NewPingu failure %v", err)
+		}
+		defer p.Close()
+		p.Start()
+		pingus = append(pingus, p)
+	}
+
+	// pingu1 knows pingu2 only, it learns pingu3 from pingu2.
+	pingus[0].RegisterWithRawAddr(addrs[1])
+	pingus[1].RegisterWithRawAddr(addrs[2])
+	pingus[2].RegisterWithRawAddr(addrs[1])
+
+	opts := pingu.ProbeOptions{
+		Interval: 10 * time.Millisecond,
+		Timeout:  10 * time.Millisecond,
+		Targets:  1,
+	}
+	for _, p := range pingus {
+		if err := p.StartProbing(opts); err != nil {
+			t.Fatalf("Gossip StartProbing failure %v", err)
+		}
+	}
+
+	time.Sleep(200 * time.Millisecond)
+	if len(pingus[0].Pingus()) != 2 {
+		t.Fatalf("Gossip invalid pingus: %v, want: %v", pingus[0].Pingus(), addrs[1:])
+	}
+	if !pingus[0].IsAlive(addrs[2]) {
+		t.Fatalf("Gossip invalid result: %v", pingus[0].PingTable())
+	}
+
+	// pingu3 is gone, pingu1 learns it.
+	pingus[2].Close()
+	time.Sleep(200 * time.Millisecond)
+	if table := pingus[0].PingTable(); table[addrs[2]] || !table[addrs[1]] {
+		t.Fatalf("Gossip invalid result: %v", table)
+	}
+}
+
+func TestProbeDetectionTime(t *testing.T) {
+	p, err := pingu.NewPingu("127.0.0.1:9393", nil)
+	if err != nil {
+		t.Fatalf("ProbeDetectionTime NewPingu failure %v", err)
+	}
+	defer p.Close()
+
+	opts := pingu.ProbeOptions{
+		Interval:      10 * time.Millisecond,
+		Timeout:       10 * time.Millisecond,
+		DetectionTime: 20 * time.Millisecond,
+	}
+	if err := p.StartProbing(opts); err == nil {
+		t.Fatalf("ProbeDetectionTime failure: accepted detection time less than 2*Interval+Timeout")
+	}
+	opts.DetectionTime = 30 * time.Millisecond
+	if err := p.StartProbing(opts); err != nil {
+		t.Fatalf("ProbeDetectionTime failure got: %v", err)
+	}
+}
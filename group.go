@@ -0,0 +1,165 @@
+// Copyright (c) 2022, Seungbae Yu <dbadoy4874@gmail.com>
+// All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package pingu
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// GroupPolicy decides the health of a group from the alive members.
+type GroupPolicy struct {
+	// min is the number of alive members needed, percent the rate of the
+	// members if min is 0.
+	min     int
+	percent float64
+}
+
+// AllOf is the policy of a group alive if all the members are alive.
+func AllOf() GroupPolicy {
+	return GroupPolicy{percent: 100}
+}
+
+// AnyOf is the policy of a group alive if any member is alive.
+func AnyOf() GroupPolicy {
+	return GroupPolicy{min: 1}
+}
+
+// AtLeast is the policy of a group alive if at least k members are alive.
+func AtLeast(k int) GroupPolicy {
+	return GroupPolicy{min: k}
+}
+
+// AtLeastPercent is the policy of a group alive if at least percent of the
+// members, rounded up, are alive.
+func AtLeastPercent(percent float64) GroupPolicy {
+	return GroupPolicy{percent: percent}
+}
+
+func (g GroupPolicy) String() string {
+	switch {
+	case g.min == 1:
+		return "any"
+	case g.min > 0:
+		return fmt.Sprintf("atleast(%d)", g.min)
+	case g.percent == 100:
+		return "all"
+	default:
+		return fmt.Sprintf("atleast(%g%%)", g.percent)
+	}
+}
+
+// need returns the number of alive members needed out of n.
+func (g GroupPolicy) need(n int) int {
+	if g.min > 0 {
+		return g.min
+	}
+	return int(math.Ceil(g.percent / 100 * float64(n)))
+}
+
+// GroupState is the state of a group.
+type GroupState struct {
+	Health Health
+	Policy GroupPolicy
+	// Members are the raw addresses of the members, Alive the alive ones.
+	Members []string
+	Alive   []string
+}
+
+// group is a named set of pingus with a health policy.
+type group struct {
+	policy  GroupPolicy
+	members []string
+	health  Health
+}
+
+// SetGroup sets the members of the group 'name' and its policy, replacing
+// the previous ones. The members must be registered to be probed.
+func (p *Pingu) SetGroup(name string, policy GroupPolicy, members ...string) error {
+	if name == "" {
+		return fmt.Errorf("invalid group name: %q", name)
+	}
+	if policy.min < 0 || policy.percent < 0 || policy.percent > 100 || (policy.min == 0 && policy.percent == 0) {
+		return fmt.Errorf("invalid group policy: %v", policy)
+	}
+	members = append([]string(nil), members...)
+	sort.Strings(members)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	g, ok := p.groups[name]
+	if !ok {
+		g = &group{health: Dead}
+		p.groups[name] = g
+	}
+	g.policy = policy
+	g.members = members
+	p.evaluate()
+	return nil
+}
+
+// RemoveGroup removes the group.
+func (p *Pingu) RemoveGroup(name string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.groups, name)
+	p.evalDerived()
+}
+
+// GroupHealth returns the state of the group, false if it's not set.
+func (p *Pingu) GroupHealth(name string) (GroupState, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	g, ok := p.groups[name]
+	if !ok {
+		return GroupState{}, false
+	}
+	return GroupState{
+		Health:  g.health,
+		Policy:  g.policy,
+		Members: append([]string(nil), g.members...),
+		Alive:   p.aliveMembers(g),
+	}, true
+}
+
+// evalGroups updates the health of the groups and sends the events of the
+// changed ones.
+//
+// The caller must hold p.mu.
+func (p *Pingu) evalGroups() {
+	now := time.Now()
+	for name, g := range p.groups {
+		h := Dead
+		if len(p.aliveMembers(g)) >= g.policy.need(len(g.members)) {
+			h = Alive
+		}
+		if h == g.health {
+			continue
+		}
+		g.health = h
+		t := EventGroupDead
+		if h == Alive {
+			t = EventGroupAlive
+		}
+		p.emit(Event{Type: t, Name: name, Time: now})
+	}
+}
+
+// aliveMembers returns the alive members of the group.
+//
+// The caller must hold p.mu.
+func (p *Pingu) aliveMembers(g *group) []string {
+	var alive []string
+	for _, addr := range g.members {
+		if st, ok := p.peers[addr]; ok && st.health == Alive {
+			alive = append(alive, addr)
+		}
+	}
+	return alive
+}
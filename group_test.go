@@ -0,0 +1,96 @@
+package pingu_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/protocol-diver/pingu"
+)
+
+func TestGroupPolicy(t *testing.T) {
+	addrs := []string{"127.0.0.1:10490", "127.0.0.1:10491", "127.0.0.1:10492", "127.0.0.1:10493"}
+	p, err := pingu.NewPingu(addrs[0], nil)
+	if err != nil {
+		t.Fatalf("Group NewPingu failure %v", err)
+	}
+	defer p.Close()
+	p.Start()
+	members := addrs[1:]
+	for i, addr := range members {
+		p.RegisterWithRawAddr(addr)
+		// The last member is down.
+		if i == len(members)-1 {
+			continue
+		}
+		other, err := pingu.NewPingu(addr, nil)
+		if err != nil {
+			t.Fatalf("Group NewPingu failure %v", err)
+		}
+		defer other.Close()
+		other.Start()
+	}
+
+	groups := map[string]pingu.GroupPolicy{
+		"all":   pingu.AllOf(),
+		"any":   pingu.AnyOf(),
+		"two":   pingu.AtLeast(2),
+		"three": pingu.AtLeast(3),
+		"half":  pingu.AtLeastPercent(50),
+		"most":  pingu.AtLeastPercent(70),
+	}
+	for name, policy := range groups {
+		if err := p.SetGroup(name, policy, members...); err != nil {
+			t.Fatalf("SetGroup failure %v", err)
+		}
+	}
+	if err := p.SetGroup("none", pingu.AtLeastPercent(0)); err == nil {
+		t.Fatalf("SetGroup expected failure on invalid policy")
+	}
+	if st, _ := p.GroupHealth("any"); st.Health != pingu.Dead {
+		t.Fatalf("GroupHealth invalid health before probes got: %v", st.Health)
+	}
+
+	sub := p.Subscribe(16)
+	defer sub.Unsubscribe()
+	if err := p.StartProbing(pingu.ProbeOptions{Interval: 10 * time.Millisecond, Timeout: 10 * time.Millisecond}); err != nil {
+		t.Fatalf("Group StartProbing failure %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	want := map[string]pingu.Health{
+		"all":   pingu.Dead,
+		"any":   pingu.Alive,
+		"two":   pingu.Alive,
+		"three": pingu.Dead,
+		"half":  pingu.Alive,
+		"most":  pingu.Dead,
+	}
+	for name, h := range want {
+		st, ok := p.GroupHealth(name)
+		if !ok || st.Health != h {
+			t.Fatalf("GroupHealth %s invalid got: %v, want: %v", name, st.Health, h)
+		}
+		if len(st.Members) != 3 || len(st.Alive) != 2 {
+			t.Fatalf("GroupHealth %s invalid members got: %v, alive: %v", name, st.Members, st.Alive)
+		}
+	}
+
+	alive := make(map[string]bool)
+	for len(sub.Events()) != 0 {
+		e := <-sub.Events()
+		switch e.Type {
+		case pingu.EventGroupAlive:
+			alive[e.Name] = true
+		case pingu.EventGroupDead:
+			t.Fatalf("GroupHealth unexpected event: %+v", e)
+		}
+	}
+	if len(alive) != 3 || !alive["any"] || !alive["two"] || !alive["half"] {
+		t.Fatalf("GroupHealth invalid events got: %v", alive)
+	}
+
+	p.RemoveGroup("any")
+	if _, ok := p.GroupHealth("any"); ok {
+		t.Fatalf("GroupHealth of removed group")
+	}
+}
@@ -0,0 +1,215 @@
+// Copyright (c) 2022, Seungbae Yu <dbadoy4874@gmail.com>
+// All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package pingu
+
+import (
+	"math"
+	"time"
+)
+
+// The RTTs are counted in log buckets, 4 per power of 2 of microseconds, so
+// a percentile is within 10% of the true value. The first bucket is under
+// 1us, the last one from about 2 minutes up.
+const (
+	histBucketsPerOctave = 4
+	histBuckets          = 1 + 27*histBucketsPerOctave
+)
+
+// rttHist counts the RTTs per bucket.
+type rttHist [histBuckets]uint32
+
+func histBucket(rtt time.Duration) int {
+	us := float64(rtt) / float64(time.Microsecond)
+	if us < 1 {
+		return 0
+	}
+	i := 1 + int(math.Log2(us)*histBucketsPerOctave)
+	if i >= histBuckets {
+		i = histBuckets - 1
+	}
+	return i
+}
+
+// histValue returns the middle of the bucket, geometrically.
+func histValue(i int) time.Duration {
+	if i == 0 {
+		return time.Microsecond / 2
+	}
+	us := math.Exp2((float64(i-1) + 0.5) / histBucketsPerOctave)
+	return time.Duration(us * float64(time.Microsecond))
+}
+
+// slider slides a window over slots of a fixed width. The oldest slot is
+// dropped as time goes, so the window covers the last n widths, give or take
+// a slot.
+type slider struct {
+	width time.Duration
+	n     int
+	// head is the current slot, started at 'start'.
+	head  int
+	start time.Time
+}
+
+// advance moves the head to the slot of now, and calls clear with the index
+// of each slot reused.
+func (s *slider) advance(now time.Time, clear func(i int)) {
+	for i := 0; now.Sub(s.start) >= s.width && i < s.n; i++ {
+		s.head = (s.head + 1) % s.n
+		clear(s.head)
+		s.start = s.start.Add(s.width)
+	}
+	if now.Sub(s.start) >= s.width {
+		s.start = now.Truncate(s.width)
+	}
+}
+
+// rttWindow is a histogram sliding over a window.
+type rttWindow struct {
+	slider
+	slots []rttHist
+}
+
+func newRTTWindow(window time.Duration, slots int) *rttWindow {
+	return &rttWindow{
+		slider: slider{width: window / time.Duration(slots), n: slots},
+		slots:  make([]rttHist, slots),
+	}
+}
+
+func (w *rttWindow) advance(now time.Time) {
+	w.slider.advance(now, func(i int) { w.slots[i] = rttHist{} })
+}
+
+func (w *rttWindow) add(rtt time.Duration, now time.Time) {
+	w.advance(now)
+	w.slots[w.head][histBucket(rtt)]++
+}
+
+// covers reports whether the window is over 'window'.
+func (w *rttWindow) covers(window time.Duration) bool {
+	return w.width == window/time.Duration(w.n)
+}
+
+// sum returns the histogram of the window and its count.
+func (w *rttWindow) sum(now time.Time) (rttHist, uint64) {
+	w.advance(now)
+	var sum rttHist
+	for i := range w.slots {
+		for j, c := range w.slots[i] {
+			sum[j] += c
+		}
+	}
+	var total uint64
+	for _, c := range sum {
+		total += uint64(c)
+	}
+	return sum, total
+}
+
+// stats returns the count and the percentiles of the window.
+func (w *rttWindow) stats(now time.Time) RTTStats {
+	sum, total := w.sum(now)
+	return RTTStats{
+		Count: total,
+		P50:   histQuantile(&sum, total, 0.5),
+		P90:   histQuantile(&sum, total, 0.9),
+		P99:   histQuantile(&sum, total, 0.99),
+		P999:  histQuantile(&sum, total, 0.999),
+	}
+}
+
+// percentile returns the q-quantile of the window, zero if empty.
+func (w *rttWindow) percentile(q float64, now time.Time) time.Duration {
+	sum, total := w.sum(now)
+	return histQuantile(&sum, total, q)
+}
+
+// histQuantile returns the q-quantile of the histogram of total RTTs, zero
+// if empty.
+func histQuantile(sum *rttHist, total uint64, q float64) time.Duration {
+	if total == 0 {
+		return 0
+	}
+	rank := uint64(math.Ceil(q * float64(total)))
+	var seen uint64
+	for i, c := range sum {
+		if seen += uint64(c); seen >= rank {
+			return histValue(i)
+		}
+	}
+	return histValue(histBuckets - 1)
+}
+
+// rttHistograms are the RTT histograms of a pingu over 1 minute in slots of
+// 10 seconds, 15 minutes in slots of 1 minute, and 1 hour in slots of 5
+// minutes.
+type rttHistograms struct {
+	m1, m15, h1 *rttWindow
+}
+
+func newRTTHistograms() *rttHistograms {
+	return &rttHistograms{
+		m1:  newRTTWindow(time.Minute, 6),
+		m15: newRTTWindow(15*time.Minute, 15),
+		h1:  newRTTWindow(time.Hour, 12),
+	}
+}
+
+func (h *rttHistograms) add(rtt time.Duration, now time.Time) {
+	h.m1.add(rtt, now)
+	h.m15.add(rtt, now)
+	h.h1.add(rtt, now)
+}
+
+// RTTStats are the percentiles of the RTTs over a window, within 10% of the
+// true values.
+type RTTStats struct {
+	// Count is the number of RTTs measured.
+	Count uint64
+	P50   time.Duration
+	P90   time.Duration
+	P99   time.Duration
+	P999  time.Duration
+}
+
+// PeerStats are the statistics of a pingu.
+type PeerStats struct {
+	// RTT1m, RTT15m and RTT1h are the RTTs over the last minute, 15 minutes
+	// and hour.
+	RTT1m  RTTStats
+	RTT15m RTTStats
+	RTT1h  RTTStats
+	// Packets1m, Packets15m and Packets1h are the pings and pongs over the
+	// last minute, 15 minutes and hour.
+	Packets1m  PacketStats
+	Packets15m PacketStats
+	Packets1h  PacketStats
+}
+
+// PeerStats returns the statistics of the pingu, false if it's not probed
+// yet.
+func (p *Pingu) PeerStats(raw string) (PeerStats, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	st, ok := p.peers[raw]
+	if !ok {
+		return PeerStats{}, false
+	}
+	var s PeerStats
+	now := time.Now()
+	if h := st.hist; h != nil {
+		s.RTT1m = h.m1.stats(now)
+		s.RTT15m = h.m15.stats(now)
+		s.RTT1h = h.h1.stats(now)
+	}
+	if t := p.seqs[raw]; t != nil {
+		s.Packets1m = t.m1.stats(now)
+		s.Packets15m = t.m15.stats(now)
+		s.Packets1h = t.h1.stats(now)
+	}
+	return s, true
+}
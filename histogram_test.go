@@ -0,0 +1,115 @@
+package pingu
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRTTWindowPercentiles(t *testing.T) {
+	now := time.Now()
+	w := newRTTWindow(time.Minute, 6)
+	// 1ms to 1000ms, so the percentiles are the values.
+	for i := 1; i <= 1000; i++ {
+		w.add(time.Duration(i)*time.Millisecond, now)
+	}
+	s := w.stats(now)
+	if s.Count != 1000 {
+		t.Fatalf("RTTWindow invalid count got: %v, want: %v", s.Count, 1000)
+	}
+	for _, c := range []struct{ got, want time.Duration }{
+		{s.P50, 500 * time.Millisecond},
+		{s.P90, 900 * time.Millisecond},
+		{s.P99, 990 * time.Millisecond},
+		{s.P999, 999 * time.Millisecond},
+	} {
+		if c.got < c.want*9/10 || c.got > c.want*11/10 {
+			t.Fatalf("RTTWindow invalid percentile got: %v, want: %v", c.got, c.want)
+		}
+	}
+}
+
+func TestRTTWindowSlide(t *testing.T) {
+	now := time.Now()
+	w := newRTTWindow(time.Minute, 6)
+	w.add(time.Second, now)
+	w.add(time.Millisecond, now.Add(30*time.Second))
+	if s := w.stats(now.Add(50 * time.Second)); s.Count != 2 {
+		t.Fatalf("RTTWindow invalid count got: %v, want: %v", s.Count, 2)
+	}
+	// The first slot slid out, not the one of 30s.
+	s := w.stats(now.Add(80 * time.Second))
+	if s.Count != 1 || s.P50 > 2*time.Millisecond {
+		t.Fatalf("RTTWindow invalid stats got: %+v", s)
+	}
+	if s := w.stats(now.Add(time.Hour)); s.Count != 0 || s.P999 != 0 {
+		t.Fatalf("RTTWindow invalid stats got: %+v", s)
+	}
+}
+
+func TestLatencyWindow(t *testing.T) {
+	addr := "127.0.0.1:12091"
+	p, err := NewPingu("127.0.0.1:12090", nil)
+	if err != nil {
+		t.Fatalf("Latency NewPingu failure %v", err)
+	}
+	defer p.Close()
+	if err := p.SetLatencyThresholds(addr, LatencyThresholds{Warning: 50 * time.Millisecond, Window: time.Hour}); err != nil {
+		t.Fatalf("SetLatencyThresholds failure %v", err)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// The slow RTTs at the start of the window still count, far more
+	// samples later.
+	now := time.Now()
+	st := &peer{latency: LatencyNormal}
+	for i := 0; i < 1000; i++ {
+		rtt := time.Millisecond
+		if i < 100 {
+			rtt = 100 * time.Millisecond
+		}
+		p.observeLatency(addr, st, rtt, now.Add(time.Duration(i)*time.Second))
+	}
+	if st.p95 < 90*time.Millisecond || st.latency != LatencyWarning {
+		t.Fatalf("Latency invalid p95 got: %v %v, want: %v", st.p95, st.latency, 100*time.Millisecond)
+	}
+
+	// They slide out of the window.
+	p.updateLatency(addr, st, now.Add(80*time.Minute))
+	if st.p95 != 0 || st.latency != LatencyNormal {
+		t.Fatalf("Latency invalid p95 got: %v %v, want: %v", st.p95, st.latency, 0)
+	}
+}
+
+func TestPeerStatsRTT(t *testing.T) {
+	addrs := []string{"127.0.0.1:11590", "127.0.0.1:11591"}
+	p, err := NewPingu(addrs[0], nil)
+	if err != nil {
+		t.Fatalf("PeerStats NewPingu failure %v", err)
+	}
+	defer p.Close()
+	p.Start()
+	other, err := NewPingu(addrs[1], nil)
+	if err != nil {
+		t.Fatalf("PeerStats NewPingu failure %v", err)
+	}
+	defer other.Close()
+	other.Start()
+	p.RegisterWithRawAddr(addrs[1])
+
+	if _, ok := p.PeerStats(addrs[1]); ok {
+		t.Fatalf("PeerStats invalid got: %v, want: %v", ok, false)
+	}
+	if err := p.StartProbing(ProbeOptions{Interval: 10 * time.Millisecond, Timeout: 10 * time.Millisecond}); err != nil {
+		t.Fatalf("PeerStats StartProbing failure %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	stats, ok := p.PeerStats(addrs[1])
+	if !ok || stats.RTT1m.Count == 0 || stats.RTT1m.P50 <= 0 || stats.RTT1m.P50 > stats.RTT1m.P999 {
+		t.Fatalf("PeerStats invalid got: %+v", stats)
+	}
+	if stats.RTT15m.Count != stats.RTT1m.Count || stats.RTT1h.Count != stats.RTT1m.Count {
+		t.Fatalf("PeerStats invalid windows got: %+v", stats)
+	}
+}
@@ -0,0 +1,202 @@
+// Copyright (c) 2022, Seungbae Yu <dbadoy4874@gmail.com>
+// All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package pingu
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// The defaults of LatencyThresholds.
+const (
+	DefaultLatencyWindow     = time.Minute
+	DefaultLatencyHysteresis = 0.1
+
+	// latencySlots is the number of slots of the window of the p95.
+	latencySlots = 10
+)
+
+// Latency is the latency level of a pingu, by the p95 of its RTT.
+type Latency uint8
+
+const (
+	// LatencyNormal is the level under the warning threshold.
+	LatencyNormal Latency = 1 + iota
+	// LatencyWarning is the level above the warning threshold, the pingu is
+	// degraded.
+	LatencyWarning
+	// LatencyCritical is the level above the critical threshold, the pingu
+	// is degraded.
+	LatencyCritical
+)
+
+func (l Latency) String() string {
+	switch l {
+	case LatencyNormal:
+		return "normal"
+	case LatencyWarning:
+		return "warning"
+	case LatencyCritical:
+		return "critical"
+	default:
+		return fmt.Sprintf("latency(%d)", l)
+	}
+}
+
+// LatencyThresholds are the RTT thresholds of the latency levels.
+type LatencyThresholds struct {
+	// Warning and Critical are compared with the p95 of the RTT over Window.
+	// The p95 is taken from a histogram, within 10% of the true value.
+	// Zero disables the level.
+	Warning  time.Duration
+	Critical time.Duration
+	// Window is the duration the RTTs are counted over, give or take a
+	// tenth, DefaultLatencyWindow if 0. Changing it restarts the count.
+	Window time.Duration
+	// Hysteresis is the fraction under a threshold the p95 must fall to
+	// leave its level, so a p95 hovering around it doesn't flap.
+	// DefaultLatencyHysteresis if 0.
+	Hysteresis float64
+}
+
+// SetLatencyThresholds sets the thresholds of the pingu at raw, or of the
+// members of the group 'raw'. The thresholds of a pingu win over the ones
+// of its groups.
+func (p *Pingu) SetLatencyThresholds(raw string, t LatencyThresholds) error {
+	if t.Warning < 0 || t.Critical < 0 || (t.Warning > 0 && t.Critical > 0 && t.Critical < t.Warning) {
+		return fmt.Errorf("invalid latency thresholds: %v, %v", t.Warning, t.Critical)
+	}
+	if t.Hysteresis < 0 || t.Hysteresis >= 1 {
+		return fmt.Errorf("invalid latency hysteresis: %v", t.Hysteresis)
+	}
+	if t.Window <= 0 {
+		t.Window = DefaultLatencyWindow
+	}
+	if t.Hysteresis == 0 {
+		t.Hysteresis = DefaultLatencyHysteresis
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.thresholds[raw] = t
+	now := time.Now()
+	for addr, st := range p.peers {
+		if st.health == Alive {
+			p.updateLatency(addr, st, now)
+		}
+	}
+	return nil
+}
+
+// latencyThresholds returns the thresholds of the pingu, false if none. The
+// window is DefaultLatencyWindow if none.
+//
+// The caller must hold p.mu.
+func (p *Pingu) latencyThresholds(rawAddr string) (LatencyThresholds, bool) {
+	if t, ok := p.thresholds[rawAddr]; ok {
+		return t, true
+	}
+	names := make([]string, 0, len(p.groups))
+	for name := range p.groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		t, ok := p.thresholds[name]
+		if ok && contains(p.groups[name].members, rawAddr) {
+			return t, true
+		}
+	}
+	return LatencyThresholds{Window: DefaultLatencyWindow}, false
+}
+
+// observeLatency records the RTT sample of the alive pingu in its
+// histograms, and updates its latency level.
+//
+// The caller must hold p.mu.
+func (p *Pingu) observeLatency(rawAddr string, st *peer, rtt time.Duration, now time.Time) {
+	if rtt <= 0 {
+		return
+	}
+	if st.hist == nil {
+		st.hist = newRTTHistograms()
+	}
+	st.hist.add(rtt, now)
+	t, _ := p.latencyThresholds(rawAddr)
+	st.latencyWindow(t.Window).add(rtt, now)
+	p.updateLatency(rawAddr, st, now)
+}
+
+// latencyWindow returns the RTT window of the p95 of the pingu, a new one if
+// the window changed.
+func (st *peer) latencyWindow(window time.Duration) *rttWindow {
+	if st.window == nil || !st.window.covers(window) {
+		st.window = newRTTWindow(window, latencySlots)
+	}
+	return st.window
+}
+
+// updateLatency updates the latency level of the pingu, and sends the event
+// if changed.
+//
+// The caller must hold p.mu.
+func (p *Pingu) updateLatency(rawAddr string, st *peer, now time.Time) {
+	t, ok := p.latencyThresholds(rawAddr)
+	st.p95 = st.latencyWindow(t.Window).percentile(0.95, now)
+
+	level := LatencyNormal
+	if ok {
+		level = t.level(st.p95, st.latency)
+	}
+	if level == st.latency {
+		return
+	}
+	st.latency = level
+	var e EventType
+	switch level {
+	case LatencyNormal:
+		e = EventLatencyNormal
+	case LatencyWarning:
+		e = EventLatencyWarning
+	case LatencyCritical:
+		e = EventLatencyCritical
+	}
+	p.emit(Event{Type: e, Addr: rawAddr, Time: now})
+}
+
+// level returns the latency level of the p95 from the current level. A
+// level is entered above its threshold and left under the hysteresis.
+func (t LatencyThresholds) level(p95 time.Duration, cur Latency) Latency {
+	below := func(d time.Duration) time.Duration {
+		return time.Duration(float64(d) * (1 - t.Hysteresis))
+	}
+	switch {
+	case t.Critical > 0 && p95 > t.Critical:
+		return LatencyCritical
+	case t.Critical > 0 && cur == LatencyCritical && p95 >= below(t.Critical):
+		return LatencyCritical
+	case t.Warning > 0 && p95 > t.Warning:
+		return LatencyWarning
+	case t.Warning > 0 && cur >= LatencyWarning && p95 >= below(t.Warning):
+		return LatencyWarning
+	default:
+		return LatencyNormal
+	}
+}
+
+// quantile returns the q-quantile of the sorted RTTs, zero if none.
+func quantile(rtts []time.Duration, q float64) time.Duration {
+	if len(rtts) == 0 {
+		return 0
+	}
+	i := int(math.Ceil(q*float64(len(rtts)))) - 1
+	if i < 0 {
+		i = 0
+	}
+	return rtts[i]
+}
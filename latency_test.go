@@ -0,0 +1,63 @@
+package pingu_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/protocol-diver/pingu"
+)
+
+func TestLatencyThresholds(t *testing.T) {
+	addrs := []string{"127.0.0.1:10690", "127.0.0.1:10691"}
+	p, err := pingu.NewPingu(addrs[0], nil)
+	if err != nil {
+		t.Fatalf("Latency NewPingu failure %v", err)
+	}
+	defer p.Close()
+	p.Start()
+	other, err := pingu.NewPingu(addrs[1], nil)
+	if err != nil {
+		t.Fatalf("Latency NewPingu failure %v", err)
+	}
+	defer other.Close()
+	other.Start()
+	p.RegisterWithRawAddr(addrs[1])
+
+	if err := p.SetLatencyThresholds(addrs[1], pingu.LatencyThresholds{Warning: time.Second, Critical: time.Millisecond}); err == nil {
+		t.Fatalf("SetLatencyThresholds expected failure on critical under warning")
+	}
+	// Any RTT is above the group warning.
+	p.SetGroup("all", pingu.AllOf(), addrs[1])
+	if err := p.SetLatencyThresholds("all", pingu.LatencyThresholds{Warning: time.Nanosecond, Critical: time.Hour}); err != nil {
+		t.Fatalf("SetLatencyThresholds failure %v", err)
+	}
+	sub := p.Subscribe(16)
+	defer sub.Unsubscribe()
+	if err := p.StartProbing(pingu.ProbeOptions{Interval: 10 * time.Millisecond, Timeout: 10 * time.Millisecond}); err != nil {
+		t.Fatalf("Latency StartProbing failure %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	st, _ := p.PeerState(addrs[1])
+	if st.Health != pingu.Alive || st.Latency != pingu.LatencyWarning || !st.Degraded() || st.P95 <= 0 {
+		t.Fatalf("Latency invalid state got: %+v", st)
+	}
+
+	// The thresholds of the pingu win over its group.
+	if err := p.SetLatencyThresholds(addrs[1], pingu.LatencyThresholds{Warning: time.Hour}); err != nil {
+		t.Fatalf("SetLatencyThresholds failure %v", err)
+	}
+	if st, _ := p.PeerState(addrs[1]); st.Latency != pingu.LatencyNormal || st.Degraded() {
+		t.Fatalf("Latency invalid state got: %+v", st)
+	}
+
+	var types []pingu.EventType
+	for len(sub.Events()) != 0 {
+		if e := <-sub.Events(); e.Type >= pingu.EventLatencyNormal {
+			types = append(types, e.Type)
+		}
+	}
+	if len(types) != 2 || types[0] != pingu.EventLatencyWarning || types[1] != pingu.EventLatencyNormal {
+		t.Fatalf("Latency invalid events got: %v", types)
+	}
+}
@@ -0,0 +1,292 @@
+// Copyright (c) 2022, Seungbae Yu <dbadoy4874@gmail.com>
+// All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package pingu
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// A lease is valid while it's renewed in time. The holder counts its duration
+// from the time it sent the request, and stops relying on it a margin before
+// the expiry. The grantor counts it from the time it received the request,
+// and frees it a margin after the expiry. The request is sent before it's
+// received, so once the grantor freed a lease, the holder stopped relying on
+// it, as long as the clocks don't drift more than the margin.
+
+// grant is a lease offered by the grantor.
+type grant struct {
+	max time.Duration
+
+	holder string
+	expiry time.Time
+
+	// seq identifies the current expiry for its timer.
+	timer *time.Timer
+	seq   uint64
+}
+
+// MaxLeaseNameLength is the longest lease name, in bytes of its JSON string,
+// so the pong answering a lease request fits a packet with its timestamps
+// and coordinate.
+const MaxLeaseNameLength = 24
+
+// validLeaseName returns an error if the lease name is empty or too long.
+func validLeaseName(name string) error {
+	b, err := json.Marshal(name)
+	if name == "" || err != nil || len(b)-2 > MaxLeaseNameLength {
+		return fmt.Errorf("invalid lease name: %q", name)
+	}
+	return nil
+}
+
+// GrantLease offers the lease 'name' to the registered pingus, one holder at a
+// time, for max duration.
+func (p *Pingu) GrantLease(name string, max time.Duration) error {
+	if err := validLeaseName(name); err != nil {
+		return err
+	}
+	if max <= 0 {
+		return fmt.Errorf("invalid lease duration: %v", max)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if g, ok := p.grants[name]; ok {
+		g.max = max
+		return nil
+	}
+	p.grants[name] = &grant{max: max}
+	return nil
+}
+
+// LeaseHolder returns the holder of the lease granted by this pingu, and the
+// time the lease expires at. It reports false if the lease is free.
+func (p *Pingu) LeaseHolder(name string) (string, time.Time, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	g, ok := p.grants[name]
+	if !ok || g.holder == "" {
+		return "", time.Time{}, false
+	}
+	return g.holder, g.expiry, true
+}
+
+// answerLease grants, renews or releases the lease for the pingu.
+func (p *Pingu) answerLease(rawAddr string, req *leaseMessage) *leaseMessage {
+	res := &leaseMessage{Name: req.Name}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	g, ok := p.grants[req.Name]
+	if !ok || !p.wl[rawAddr] {
+		return res
+	}
+	now := time.Now()
+	if req.Release {
+		if g.holder == rawAddr {
+			p.freeLease(req.Name, g, EventLeaseReleased, now)
+		}
+		return res
+	}
+	if g.holder != "" && g.holder != rawAddr {
+		return res
+	}
+	d := time.Duration(req.Duration) * time.Millisecond
+	if d <= 0 {
+		return res
+	}
+	if d > g.max {
+		d = g.max
+	}
+	if g.holder == "" {
+		g.holder = rawAddr
+		p.emit(Event{Type: EventLeaseGranted, Addr: rawAddr, Name: req.Name, Time: now})
+	}
+	g.expiry = now.Add(d + p.cfg.leaseMargin(d))
+	if g.timer != nil {
+		g.timer.Stop()
+	}
+	g.seq++
+	seq := g.seq
+	g.timer = time.AfterFunc(time.Until(g.expiry), func() {
+		p.expireLease(req.Name, g, seq)
+	})
+
+	res.Duration = d.Milliseconds()
+	res.Granted = true
+	return res
+}
+
+// expireLease frees the lease, unless it was renewed since.
+func (p *Pingu) expireLease(name string, g *grant, seq uint64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if g.seq != seq || g.holder == "" {
+		return
+	}
+	p.freeLease(name, g, EventLeaseExpired, time.Now())
+}
+
+// freeLease frees the lease and sends the event.
+//
+// The caller must hold p.mu.
+func (p *Pingu) freeLease(name string, g *grant, t EventType, now time.Time) {
+	p.emit(Event{Type: t, Addr: g.holder, Name: name, Time: now})
+	if g.timer != nil {
+		g.timer.Stop()
+	}
+	g.seq++
+	g.holder = ""
+	g.expiry = time.Time{}
+}
+
+// Lease is a lease held from a grantor. It's renewed every third of the
+// duration granted until released or expired.
+type Lease struct {
+	p        *Pingu
+	addr     *net.UDPAddr
+	name     string
+	duration time.Duration
+
+	mu     sync.Mutex
+	expiry time.Time
+	// granted is the duration of the last grant, at most duration.
+	granted time.Duration
+
+	done    chan struct{}
+	release chan struct{}
+	once    sync.Once
+}
+
+// AcquireLease requests the lease 'name' of duration d to the grantor at
+// 'raw', and waits for the answer until timeout. The Pingu must be started.
+func (p *Pingu) AcquireLease(raw string, name string, d, timeout time.Duration) (*Lease, error) {
+	if err := validLeaseName(name); err != nil {
+		return nil, err
+	}
+	if d < 3*time.Millisecond {
+		return nil, fmt.Errorf("invalid lease duration: %v", d)
+	}
+	addr, err := rawAddrToUDPAddr(raw)
+	if err != nil {
+		return nil, err
+	}
+	l := &Lease{
+		p:        p,
+		addr:     addr,
+		name:     name,
+		duration: d,
+		done:     make(chan struct{}),
+		release:  make(chan struct{}),
+	}
+	if err := l.renew(timeout); err != nil {
+		return nil, err
+	}
+	go l.loop()
+	return l, nil
+}
+
+// Expiry returns the time the holder must stop relying on the lease.
+func (l *Lease) Expiry() time.Time {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.expiry
+}
+
+// Done returns a channel closed when the lease expired or is released.
+func (l *Lease) Done() <-chan struct{} {
+	return l.done
+}
+
+// Release stops renewing the lease and frees it at the grantor.
+func (l *Lease) Release() {
+	l.once.Do(func() {
+		close(l.release)
+	})
+}
+
+// renew requests the lease, and extends the expiry if granted.
+func (l *Lease) renew(timeout time.Duration) error {
+	sent := time.Now()
+	r, err := l.p.request(l.addr, &pingPacket{Lease: &leaseMessage{Name: l.name, Duration: l.duration.Milliseconds()}}, timeout)
+	if err != nil {
+		return err
+	}
+	if r.Lease == nil || !r.Lease.Granted {
+		return fmt.Errorf("lease %q denied by %v", l.name, l.addr)
+	}
+	d := time.Duration(r.Lease.Duration) * time.Millisecond
+	expiry := sent.Add(d - l.p.cfg.leaseMargin(d))
+	if d < 3*time.Millisecond || !expiry.After(time.Now()) {
+		return fmt.Errorf("lease %q too short: %v", l.name, d)
+	}
+	l.mu.Lock()
+	l.expiry = expiry
+	l.granted = d
+	l.mu.Unlock()
+	return nil
+}
+
+// interval returns the renewal interval of the lease.
+func (l *Lease) interval() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.granted / 3
+}
+
+func (l *Lease) loop() {
+	defer close(l.done)
+
+	interval := l.interval()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	expiry := time.NewTimer(time.Until(l.Expiry()))
+	defer expiry.Stop()
+	for {
+		// The ticker is always ready if the renewals time out, don't let it
+		// win over the expiry.
+		select {
+		case <-expiry.C:
+			l.expire()
+			return
+		default:
+		}
+		select {
+		case <-ticker.C:
+			if err := l.renew(interval); err != nil {
+				continue
+			}
+			// The grantor may change the duration granted.
+			if next := l.interval(); next != interval {
+				interval = next
+				ticker.Reset(interval)
+			}
+			// Too late if it expired in the meantime.
+			if expiry.Stop() {
+				expiry.Reset(time.Until(l.Expiry()))
+			}
+		case <-expiry.C:
+			l.expire()
+			return
+		case <-l.release:
+			req := &pingPacket{Lease: &leaseMessage{Name: l.name, Release: true}}
+			if _, err := l.p.send(l.addr, req); err != nil {
+				l.p.logSendError(err)
+			}
+			return
+		}
+	}
+}
+
+func (l *Lease) expire() {
+	l.p.mu.Lock()
+	defer l.p.mu.Unlock()
+	l.p.emit(Event{Type: EventLeaseExpired, Addr: l.addr.String(), Name: l.name, Time: time.Now()})
+}
@@ -0,0 +1,149 @@
+package pingu_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/protocol-diver/pingu"
+)
+
+func TestLease(t *testing.T) {
+	addrs := []string{"127.0.0.1:9890", "127.0.0.1:9891", "127.0.0.1:9892"}
+	pingus := make([]*pingu.Pingu, 0, len(addrs))
+	for _, addr := range addrs {
+		p, err := pingu.NewPingu(addr, nil)
+		if err != nil {
+			t.Fatalf("Lease NewPingu failure %v", err)
+		}
+		defer p.Close()
+		p.Start()
+		pingus = append(pingus, p)
+	}
+	grantor, holder, other := pingus[0], pingus[1], pingus[2]
+	grantor.RegisterWithRawAddr(addrs[1])
+	grantor.RegisterWithRawAddr(addrs[2])
+
+	if _, err := holder.AcquireLease(addrs[0], "leader", 60*time.Millisecond, 20*time.Millisecond); err == nil {
+		t.Fatalf("AcquireLease failure: granted a lease not offered")
+	}
+	if err := grantor.GrantLease("leader", time.Second); err != nil {
+		t.Fatalf("GrantLease failure %v", err)
+	}
+	lease, err := holder.AcquireLease(addrs[0], "leader", 60*time.Millisecond, 20*time.Millisecond)
+	if err != nil {
+		t.Fatalf("AcquireLease failure %v", err)
+	}
+	if _, err := other.AcquireLease(addrs[0], "leader", 60*time.Millisecond, 20*time.Millisecond); err == nil {
+		t.Fatalf("AcquireLease failure: granted a held lease")
+	}
+
+	// The holder renews the lease.
+	time.Sleep(150 * time.Millisecond)
+	if !lease.Expiry().After(time.Now()) {
+		t.Fatalf("Lease invalid expiry: %v", lease.Expiry())
+	}
+	holderAddr, expiry, ok := grantor.LeaseHolder("leader")
+	if !ok || holderAddr != addrs[1] || !expiry.After(lease.Expiry()) {
+		t.Fatalf("LeaseHolder invalid result: %v %v, holder expiry: %v", holderAddr, expiry, lease.Expiry())
+	}
+
+	lease.Release()
+	<-lease.Done()
+	time.Sleep(10 * time.Millisecond)
+	if _, _, ok := grantor.LeaseHolder("leader"); ok {
+		t.Fatalf("LeaseHolder failure: lease not released")
+	}
+
+	// The grantor is gone, the lease expires.
+	sub := other.Subscribe(4)
+	defer sub.Unsubscribe()
+	lease, err = other.AcquireLease(addrs[0], "leader", 60*time.Millisecond, 20*time.Millisecond)
+	if err != nil {
+		t.Fatalf("AcquireLease failure %v", err)
+	}
+	grantor.Stop()
+	select {
+	case <-lease.Done():
+	case <-time.After(200 * time.Millisecond):
+		t.Fatalf("Lease failure: not expired")
+	}
+	if e := <-sub.Events(); e.Type != pingu.EventLeaseExpired || e.Name != "leader" {
+		t.Fatalf("Lease invalid event: %v %v", e.Type, e.Name)
+	}
+}
+
+func TestLeaseName(t *testing.T) {
+	addrs := []string{"127.0.0.1:11490", "127.0.0.1:11491"}
+	pingus := make([]*pingu.Pingu, 0, len(addrs))
+	for _, addr := range addrs {
+		p, err := pingu.NewPingu(addr, nil)
+		if err != nil {
+			t.Fatalf("Lease NewPingu failure %v", err)
+		}
+		defer p.Close()
+		p.Start()
+		pingus = append(pingus, p)
+	}
+	grantor, holder := pingus[0], pingus[1]
+	grantor.RegisterWithRawAddr(addrs[1])
+	grantor.SetLoad(1.2345678901234567e-300)
+
+	// The longest name fits the pong.
+	name := strings.Repeat("x", pingu.MaxLeaseNameLength)
+	if err := grantor.GrantLease(name, time.Second); err != nil {
+		t.Fatalf("GrantLease failure %v", err)
+	}
+	lease, err := holder.AcquireLease(addrs[0], name, time.Second, 50*time.Millisecond)
+	if err != nil {
+		t.Fatalf("AcquireLease failure %v", err)
+	}
+	lease.Release()
+
+	// Escaped in JSON, '<' takes 6 bytes.
+	for _, name := range []string{"", strings.Repeat("x", pingu.MaxLeaseNameLength+1), "<<<<<"} {
+		if err := grantor.GrantLease(name, time.Second); err == nil {
+			t.Fatalf("GrantLease expected failure on name %q", name)
+		}
+		if _, err := holder.AcquireLease(addrs[0], name, time.Second, 50*time.Millisecond); err == nil {
+			t.Fatalf("AcquireLease expected failure on name %q", name)
+		}
+	}
+}
+
+func TestLeaseShortGrant(t *testing.T) {
+	addrs := []string{"127.0.0.1:11492", "127.0.0.1:11493"}
+	pingus := make([]*pingu.Pingu, 0, len(addrs))
+	for _, addr := range addrs {
+		p, err := pingu.NewPingu(addr, nil)
+		if err != nil {
+			t.Fatalf("Lease NewPingu failure %v", err)
+		}
+		defer p.Close()
+		p.Start()
+		pingus = append(pingus, p)
+	}
+	grantor, holder := pingus[0], pingus[1]
+	grantor.RegisterWithRawAddr(addrs[1])
+
+	// Granted less than requested, the holder renews on the grant.
+	if err := grantor.GrantLease("leader", 60*time.Millisecond); err != nil {
+		t.Fatalf("GrantLease failure %v", err)
+	}
+	lease, err := holder.AcquireLease(addrs[0], "leader", 600*time.Millisecond, 20*time.Millisecond)
+	if err != nil {
+		t.Fatalf("AcquireLease failure %v", err)
+	}
+	defer lease.Release()
+	for i := 0; i < 5; i++ {
+		time.Sleep(50 * time.Millisecond)
+		select {
+		case <-lease.Done():
+			t.Fatalf("Lease failure: expired while renewed")
+		default:
+		}
+		if !lease.Expiry().After(time.Now()) {
+			t.Fatalf("Lease invalid expiry: %v", lease.Expiry())
+		}
+	}
+}
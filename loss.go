@@ -0,0 +1,149 @@
+// Copyright (c) 2022, Seungbae Yu <dbadoy4874@gmail.com>
+// All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package pingu
+
+import "time"
+
+// The pings of a probe carry a sequence number per pingu, echoed by the
+// pongs. A pong is duplicated if its sequence was already answered, and
+// reordered if it arrives after the pong of a later ping. The pongs are
+// remembered up to ackWindow sequences back, the older ones count as
+// reordered.
+const ackWindow = 64
+
+// PacketStats are the counts of the pings and pongs over a window.
+type PacketStats struct {
+	Sent       uint64
+	Received   uint64
+	Duplicated uint64
+	Reordered  uint64
+}
+
+// Lost returns the number of the pings not answered, including the ones
+// still in flight.
+func (s PacketStats) Lost() uint64 {
+	if s.Received >= s.Sent {
+		return 0
+	}
+	return s.Sent - s.Received
+}
+
+// LossRate returns the rate of the pings not answered, 0 if none was sent.
+func (s PacketStats) LossRate() float64 {
+	if s.Sent == 0 {
+		return 0
+	}
+	return float64(s.Lost()) / float64(s.Sent)
+}
+
+// packetWindow counts the packets sliding over a window.
+type packetWindow struct {
+	slider
+	slots []PacketStats
+}
+
+func newPacketWindow(window time.Duration, slots int) *packetWindow {
+	return &packetWindow{
+		slider: slider{width: window / time.Duration(slots), n: slots},
+		slots:  make([]PacketStats, slots),
+	}
+}
+
+// add counts at now with f.
+func (w *packetWindow) add(now time.Time, f func(s *PacketStats)) {
+	w.advance(now, func(i int) { w.slots[i] = PacketStats{} })
+	f(&w.slots[w.head])
+}
+
+func (w *packetWindow) stats(now time.Time) PacketStats {
+	w.advance(now, func(i int) { w.slots[i] = PacketStats{} })
+	var sum PacketStats
+	for _, s := range w.slots {
+		sum.Sent += s.Sent
+		sum.Received += s.Received
+		sum.Duplicated += s.Duplicated
+		sum.Reordered += s.Reordered
+	}
+	return sum
+}
+
+// seqTracker numbers the pings to a pingu and accounts for their pongs,
+// over the same windows as the RTT histograms.
+type seqTracker struct {
+	// seq is the sequence of the last ping, highest of the latest pong.
+	seq     uint32
+	highest uint32
+	// acked has the bit i set if the pong of highest-i arrived.
+	acked uint64
+
+	m1, m15, h1 *packetWindow
+}
+
+func newSeqTracker() *seqTracker {
+	return &seqTracker{
+		m1:  newPacketWindow(time.Minute, 6),
+		m15: newPacketWindow(15*time.Minute, 15),
+		h1:  newPacketWindow(time.Hour, 12),
+	}
+}
+
+func (t *seqTracker) add(now time.Time, f func(s *PacketStats)) {
+	t.m1.add(now, f)
+	t.m15.add(now, f)
+	t.h1.add(now, f)
+}
+
+// nextSeq returns the sequence of a ping to the registered pingu, 0 if not
+// registered.
+//
+// The caller must hold p.mu.
+func (p *Pingu) nextSeq(rawAddr string, now time.Time) uint32 {
+	if !p.wl[rawAddr] {
+		return 0
+	}
+	t, ok := p.seqs[rawAddr]
+	if !ok {
+		t = newSeqTracker()
+		p.seqs[rawAddr] = t
+	}
+	t.seq++
+	if t.seq == 0 {
+		t.seq++
+	}
+	t.add(now, func(s *PacketStats) { s.Sent++ })
+	return t.seq
+}
+
+// ackSeq accounts for the pong of the sequence.
+//
+// The caller must hold p.mu.
+func (p *Pingu) ackSeq(rawAddr string, seq uint32, now time.Time) {
+	t, ok := p.seqs[rawAddr]
+	if !ok || seq == 0 {
+		return
+	}
+	// The difference wraps around with the sequences.
+	d := int32(seq - t.highest)
+	switch {
+	case d > 0:
+		if d >= ackWindow {
+			t.acked = 0
+		} else {
+			t.acked <<= uint(d)
+		}
+		t.acked |= 1
+		t.highest = seq
+		t.add(now, func(s *PacketStats) { s.Received++ })
+	case -d >= ackWindow:
+		t.add(now, func(s *PacketStats) { s.Received++; s.Reordered++ })
+	case t.acked&(1<<uint(-d)) != 0:
+		t.add(now, func(s *PacketStats) { s.Duplicated++ })
+	default:
+		t.acked |= 1 << uint(-d)
+		t.add(now, func(s *PacketStats) { s.Received++; s.Reordered++ })
+	}
+}
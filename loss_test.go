@@ -0,0 +1,117 @@
+package pingu
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSeqAccounting(t *testing.T) {
+	p, err := NewPingu("127.0.0.1:10790", nil)
+	if err != nil {
+		t.Fatalf("Seq NewPingu failure %v", err)
+	}
+	defer p.Close()
+	addr := "127.0.0.1:10791"
+	p.RegisterWithRawAddr(addr)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	if seq := p.nextSeq("127.0.0.1:10792", now); seq != 0 {
+		t.Fatalf("Seq of unregistered pingu got: %v, want: %v", seq, 0)
+	}
+	for i := 0; i < 10; i++ {
+		p.nextSeq(addr, now)
+	}
+	// 1, 2, 4, 3 late, 2 twice, 5 to 10 lost.
+	for _, seq := range []uint32{1, 2, 4, 3, 2} {
+		p.ackSeq(addr, seq, now)
+	}
+	want := PacketStats{Sent: 10, Received: 4, Duplicated: 1, Reordered: 1}
+	got := p.seqs[addr].m1.stats(now)
+	if got != want {
+		t.Fatalf("Seq invalid stats got: %+v, want: %+v", got, want)
+	}
+	if got.Lost() != 6 || got.LossRate() != 0.6 {
+		t.Fatalf("Seq invalid loss got: %v, %v", got.Lost(), got.LossRate())
+	}
+	// The minute slid out, not the hour.
+	later := now.Add(2 * time.Minute)
+	if s := p.seqs[addr].m1.stats(later); s != (PacketStats{}) {
+		t.Fatalf("Seq invalid stats got: %+v", s)
+	}
+	if s := p.seqs[addr].h1.stats(later); s != want {
+		t.Fatalf("Seq invalid stats got: %+v, want: %+v", s, want)
+	}
+}
+
+func TestPingPongNotProbed(t *testing.T) {
+	addrs := []string{"127.0.0.1:10795", "127.0.0.1:10796"}
+	pingus := make([]*Pingu, 0, len(addrs))
+	for _, addr := range addrs {
+		p, err := NewPingu(addr, nil)
+		if err != nil {
+			t.Fatalf("PingPong NewPingu failure %v", err)
+		}
+		defer p.Close()
+		p.Start()
+		pingus = append(pingus, p)
+	}
+	p := pingus[0]
+	p.RegisterWithRawAddr(addrs[1])
+
+	// The pings are counted, the pingu is not probed yet.
+	if err := p.PingPongWithRawAddr(addrs[1], time.Second); err != nil {
+		t.Fatalf("PingPong failure %v", err)
+	}
+	if alive, ok := p.PingTable()[addrs[1]]; ok {
+		t.Fatalf("PingTable invalid entry got: %v, want: none", alive)
+	}
+	if _, ok := p.PeerState(addrs[1]); ok {
+		t.Fatalf("PeerState invalid got: %v, want: %v", ok, false)
+	}
+	if s, _ := p.PeerStats(addrs[1]); s.Packets1m.Sent != 0 {
+		t.Fatalf("PeerStats invalid got: %+v, want: none", s)
+	}
+
+	if err := p.StartProbing(ProbeOptions{Interval: 10 * time.Millisecond, Timeout: 50 * time.Millisecond}); err != nil {
+		t.Fatalf("PingPong StartProbing failure %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if alive := p.PingTable()[addrs[1]]; !alive || !p.IsAlive(addrs[1]) {
+		t.Fatalf("PingTable invalid got: %v, want: %v", alive, true)
+	}
+	if s, _ := p.PeerStats(addrs[1]); s.Packets1m.Sent < 2 || s.Packets1m.Received < 2 {
+		t.Fatalf("PeerStats invalid got: %+v", s.Packets1m)
+	}
+}
+
+func TestPeerStatsPackets(t *testing.T) {
+	addrs := []string{"127.0.0.1:11690", "127.0.0.1:11691"}
+	p, err := NewPingu(addrs[0], nil)
+	if err != nil {
+		t.Fatalf("PeerStats NewPingu failure %v", err)
+	}
+	defer p.Close()
+	p.Start()
+	other, err := NewPingu(addrs[1], nil)
+	if err != nil {
+		t.Fatalf("PeerStats NewPingu failure %v", err)
+	}
+	defer other.Close()
+	other.Start()
+	p.RegisterWithRawAddr(addrs[1])
+	if err := p.StartProbing(ProbeOptions{Interval: 10 * time.Millisecond, Timeout: 10 * time.Millisecond}); err != nil {
+		t.Fatalf("PeerStats StartProbing failure %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	// The last ping may be in flight.
+	stats, _ := p.PeerStats(addrs[1])
+	if pk := stats.Packets1m; pk.Sent == 0 || pk.Received == 0 || pk.Duplicated != 0 || pk.Lost() > 1 {
+		t.Fatalf("PeerStats invalid packets got: %+v", pk)
+	}
+	if stats.Packets1h != stats.Packets1m {
+		t.Fatalf("PeerStats invalid packets got: %+v, want: %+v", stats.Packets1h, stats.Packets1m)
+	}
+}
@@ -7,31 +7,98 @@
 package pingu
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"net"
+	"time"
 )
 
 const (
 	ping = iota
 	pong
+	beat
 
 	packetTypeIndex = 0
 	packetSizeIndex = 1
 	prefixSize      = 2
+
+	// The packet size is stored in a byte.
+	maxPayloadSize = 255
 )
 
 type packet interface {
 	SetSender(s *net.UDPAddr)
 	Sender() *net.UDPAddr
 	Kind() byte
+	Header() *header
+}
+
+// header is the part of the packet shared by all packet types.
+type header struct {
+	// Nonce pairs a pong with its ping.
+	Nonce uint32 `json:"n,omitempty"`
+	// Incarnation of the sender, see Config.Gossip.
+	Incarnation uint32 `json:"i,omitempty"`
+	// Gossip is the piggybacked peer state updates.
+	Gossip []update `json:"g,omitempty"`
+	// Coord is the Vivaldi coordinate of the sender, see EstimateRTT.
+	Coord []float32 `json:"v,omitempty"`
+
+	// pad is the padding after the payload, sent up to padTo bytes in all,
+	// see ProbePathMTU. size is the size of the packet on the wire.
+	pad   []byte
+	padTo int
+	size  int
 }
 
 type pingPacket struct {
+	header
+	// Seq numbers the pings of the probes to a pingu, see PeerStats.
+	Seq uint32 `json:"q,omitempty"`
+	// Lease is the lease request, see AcquireLease.
+	Lease  *leaseMessage `json:"l,omitempty"`
 	sender *net.UDPAddr
+	recvAt time.Time
 }
 
 type pongPacket struct {
+	header
+	// Seq is the sequence of the ping.
+	Seq uint32 `json:"q,omitempty"`
+	// Lease is the answer to the lease request.
+	Lease *leaseMessage `json:"l,omitempty"`
+	// Load is the load of the sender, see SetLoad.
+	Load float64 `json:"w,omitempty"`
+	// Recv and Sent are the times in microseconds since the Unix epoch the
+	// ping was received and the pong sent, see PeerState.ClockOffset.
+	Recv   int64 `json:"t2,omitempty"`
+	Sent   int64 `json:"t3,omitempty"`
+	sender *net.UDPAddr
+	recvAt time.Time
+}
+
+// leaseMessage is a lease request or its answer.
+type leaseMessage struct {
+	Name string `json:"n"`
+	// Duration in milliseconds, requested or granted.
+	Duration int64 `json:"d,omitempty"`
+	Release  bool  `json:"r,omitempty"`
+	Granted  bool  `json:"ok,omitempty"`
+}
+
+// beatPacket is an unsolicited heartbeat, see Beater and SendBeat.
+type beatPacket struct {
+	header
+	// Interval is the beat interval of the sender in milliseconds.
+	Interval int64 `json:"d,omitempty"`
+	// ID is the raw address the collectors registered the sender with, see
+	// Beater.SetID.
+	ID string `json:"id,omitempty"`
+	// Check is the name of the check, Status the exit status of the job, in
+	// the beat of a scheduled job.
+	Check  string `json:"c,omitempty"`
+	Status int    `json:"s,omitempty"`
 	sender *net.UDPAddr
 }
 
@@ -43,6 +110,8 @@ func parsePacket(d []byte, sender *net.UDPAddr) (packet, error) {
 		r = new(pingPacket)
 	case pong:
 		r = new(pongPacket)
+	case beat:
+		r = new(beatPacket)
 	default:
 		return nil, fmt.Errorf("invalid packet type: %d", d[packetTypeIndex])
 	}
@@ -59,13 +128,21 @@ func suitablePack(b []byte, packet packet) error {
 	if !isValidPacketType(b[packetTypeIndex]) {
 		return fmt.Errorf("invalid packet type: %d", b[packetTypeIndex])
 	}
-	len := b[packetSizeIndex]
-	byt := make([]byte, len)
-	copy(byt[:], b[prefixSize:prefixSize+len])
+	size := int(b[packetSizeIndex])
+	if prefixSize+size > len(b) {
+		return fmt.Errorf("invalid packet size: %d", size)
+	}
+	byt := make([]byte, size)
+	copy(byt[:], b[prefixSize:prefixSize+size])
 
 	if err := json.Unmarshal(byt, packet); err != nil {
 		return fmt.Errorf("invalid packet data: %v", err)
 	}
+	h := packet.Header()
+	h.size = len(b)
+	if len(b) > prefixSize+size {
+		h.pad = append([]byte(nil), b[prefixSize+size:]...)
+	}
 	return nil
 }
 
@@ -79,12 +156,35 @@ func suitableUnpack(packet packet) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
-	result := make([]byte, len(b)+prefixSize)
+	if len(b) > maxPayloadSize {
+		return nil, fmt.Errorf("packet too large: %d", len(b))
+	}
+	h := packet.Header()
+	if n := h.padTo - prefixSize - len(b); n > 0 {
+		h.pad = padding(n, byte(h.Nonce))
+	}
+	h.size = len(b) + prefixSize + len(h.pad)
+	result := make([]byte, len(b)+prefixSize, h.size)
 	result[packetTypeIndex] = packet.Kind()
 	result[packetSizeIndex] = byte(len(b))
 	copy(result[2:], b[:])
 
-	return result, nil
+	return append(result, h.pad...), nil
+}
+
+// padding returns n bytes of a pattern starting from seed, so a corrupted
+// padding doesn't look intact.
+func padding(n int, seed byte) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = seed + byte(i)*31
+	}
+	return b
+}
+
+// padded reports whether the packet has an intact padding.
+func (h *header) padded() bool {
+	return len(h.pad) > 0 && bytes.Equal(h.pad, padding(len(h.pad), byte(h.Nonce)))
 }
 
 func isValidPacketType(b byte) bool {
@@ -93,6 +193,8 @@ func isValidPacketType(b byte) bool {
 		return true
 	case pong:
 		return true
+	case beat:
+		return true
 	default:
 		return false
 	}
@@ -101,7 +203,14 @@ func isValidPacketType(b byte) bool {
 func (p *pingPacket) SetSender(s *net.UDPAddr) { p.sender = s }
 func (p *pingPacket) Sender() *net.UDPAddr     { return p.sender }
 func (p *pingPacket) Kind() byte               { return ping }
+func (p *pingPacket) Header() *header          { return &p.header }
 
 func (p *pongPacket) SetSender(s *net.UDPAddr) { p.sender = s }
 func (p *pongPacket) Sender() *net.UDPAddr     { return p.sender }
 func (p *pongPacket) Kind() byte               { return pong }
+func (p *pongPacket) Header() *header          { return &p.header }
+
+func (p *beatPacket) SetSender(s *net.UDPAddr) { p.sender = s }
+func (p *beatPacket) Sender() *net.UDPAddr     { return p.sender }
+func (p *beatPacket) Kind() byte               { return beat }
+func (p *beatPacket) Header() *header          { return &p.header }
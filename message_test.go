@@ -2,10 +2,13 @@ package pingu
 
 import (
 	"bytes"
+	"math"
 	"net"
 	"net/netip"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestParsePacket(t *testing.T) {
@@ -109,3 +112,19 @@ func TestSuitableUnpack(t *testing.T) {
 		}
 	}
 }
+
+func TestLeasePongSize(t *testing.T) {
+	// The largest values but the timestamps, which have 16 digits until 2286.
+	coord := []float32{-math.MaxFloat32, -math.SmallestNonzeroFloat32, -1.2345678e-30, -1.2345678e+30}
+	r := &pongPacket{
+		header: header{Nonce: math.MaxUint32, Incarnation: math.MaxUint32, Coord: coord},
+		Seq:    math.MaxUint32,
+		Lease:  &leaseMessage{Name: strings.Repeat("x", MaxLeaseNameLength), Duration: math.MaxInt64 / int64(time.Millisecond), Granted: true},
+		Load:   -1.2345678901234567e-300,
+		Recv:   time.Date(2286, 1, 1, 0, 0, 0, 0, time.UTC).UnixMicro(),
+		Sent:   time.Date(2286, 1, 1, 0, 0, 0, 0, time.UTC).UnixMicro(),
+	}
+	if _, err := suitableUnpack(r); err != nil {
+		t.Fatalf("suitableUnpack failure %v", err)
+	}
+}
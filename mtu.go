@@ -0,0 +1,71 @@
+// Copyright (c) 2022, Seungbae Yu <dbadoy4874@gmail.com>
+// All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package pingu
+
+import (
+	"fmt"
+	"time"
+)
+
+// mtuAttempts is the number of pings of a size before it's taken as too
+// large, so a lost packet doesn't shrink the result.
+const mtuAttempts = 2
+
+// ProbePathMTU finds the largest packet that makes the round trip to the
+// pingu at raw intact, up to Config.MaxPacketSize. The pings are padded to
+// the sizes searched and the pongs are padded as the pings if their padding
+// arrived intact, so a size that is dropped, truncated or corrupted either
+// way fails. Each size waits up to
+// timeout. The Pingu must be started, and the other Pingu's MaxPacketSize
+// must be as large.
+//
+// The size is the UDP payload, and is stored in PeerState.PathMTU if the
+// pingu is registered.
+func (p *Pingu) ProbePathMTU(raw string, timeout time.Duration) (int, error) {
+	addr, err := rawAddrToUDPAddr(raw)
+	if err != nil {
+		return 0, err
+	}
+	if !p.running() {
+		return 0, ErrNotRunning
+	}
+	try := func(size int) bool {
+		for i := 0; i < mtuAttempts; i++ {
+			ping := &pingPacket{}
+			ping.padTo = size
+			r, err := p.request(addr, ping, timeout)
+			if err == nil && r.padded() && r.size == ping.size {
+				return true
+			}
+		}
+		return false
+	}
+
+	lo, hi := DefaultMaxPacketSize, p.cfg.MaxPacketSize
+	if !try(lo) {
+		return 0, fmt.Errorf("path mtu probe failed ip: %v, size: %d", raw, lo)
+	}
+	if !try(hi) {
+		// lo makes it, hi doesn't.
+		for hi-lo > 1 {
+			mid := lo + (hi-lo)/2
+			if try(mid) {
+				lo = mid
+			} else {
+				hi = mid
+			}
+		}
+		hi = lo
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if st, ok := p.peers[raw]; ok && p.wl[raw] {
+		st.pathMTU = hi
+	}
+	return hi, nil
+}
@@ -0,0 +1,48 @@
+package pingu_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/protocol-diver/pingu"
+)
+
+func TestProbePathMTU(t *testing.T) {
+	addrs := []string{"127.0.0.1:10990", "127.0.0.1:10991", "127.0.0.1:10992"}
+	sizes := []int{4000, 1500, 8000}
+	pingus := make([]*pingu.Pingu, 0, len(addrs))
+	for i, addr := range addrs {
+		p, err := pingu.NewPingu(addr, &pingu.Config{MaxPacketSize: sizes[i]})
+		if err != nil {
+			t.Fatalf("PathMTU NewPingu failure %v", err)
+		}
+		defer p.Close()
+		p.Start()
+		pingus = append(pingus, p)
+	}
+	p := pingus[0]
+	p.RegisterWithRawAddr(addrs[1])
+	if err := p.StartProbing(pingu.ProbeOptions{Interval: 10 * time.Millisecond, Timeout: 10 * time.Millisecond}); err != nil {
+		t.Fatalf("PathMTU StartProbing failure %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	// The other pingu truncates the larger pings.
+	size, err := p.ProbePathMTU(addrs[1], 50*time.Millisecond)
+	if err != nil || size != 1500 {
+		t.Fatalf("ProbePathMTU failure got: %v, %v, want: %v", size, err, 1500)
+	}
+	if st, _ := p.PeerState(addrs[1]); st.PathMTU != 1500 {
+		t.Fatalf("PeerState invalid PathMTU got: %v, want: %v", st.PathMTU, 1500)
+	}
+
+	// Up to our own maximum.
+	if size, err := p.ProbePathMTU(addrs[2], 50*time.Millisecond); err != nil || size != 4000 {
+		t.Fatalf("ProbePathMTU failure got: %v, %v, want: %v", size, err, 4000)
+	}
+
+	pingus[1].Close()
+	if _, err := p.ProbePathMTU(addrs[1], 20*time.Millisecond); err == nil {
+		t.Fatalf("ProbePathMTU expected failure on closed pingu")
+	}
+}
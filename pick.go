@@ -0,0 +1,174 @@
+// Copyright (c) 2022, Seungbae Yu <dbadoy4874@gmail.com>
+// All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package pingu
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"net"
+	"sort"
+)
+
+// Strategy is the way Pick chooses among the alive pingus.
+type Strategy uint8
+
+const (
+	// PickRandom picks uniformly at random.
+	PickRandom Strategy = 1 + iota
+	// PickRoundRobin picks each alive pingu in turn.
+	PickRoundRobin
+	// PickLowestRTT picks the pingu with the lowest round-trip time.
+	PickLowestRTT
+	// PickLeastLoaded picks at random, weighted by the spare capacity. A
+	// pingu reporting the load L has the weight 1/(1+L), see SetLoad.
+	PickLeastLoaded
+)
+
+func (s Strategy) String() string {
+	switch s {
+	case PickRandom:
+		return "random"
+	case PickRoundRobin:
+		return "round-robin"
+	case PickLowestRTT:
+		return "lowest-rtt"
+	case PickLeastLoaded:
+		return "least-loaded"
+	default:
+		return fmt.Sprintf("strategy(%d)", s)
+	}
+}
+
+// SetLoad sets the load reported to the pingus probing this one. It's
+// meaningful to them with PickLeastLoaded, so a non-negative value in the
+// same unit on all the pingus, like the number of requests in flight.
+func (p *Pingu) SetLoad(load float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.load = load
+}
+
+// Pick returns the raw address of a registered alive pingu chosen with the
+// strategy.
+func (p *Pingu) Pick(s Strategy) (string, error) {
+	ranked, err := p.rank(s, nil)
+	if err != nil {
+		return "", err
+	}
+	return ranked[0], nil
+}
+
+// rank returns the raw addresses of the registered alive pingus, in order of
+// preference with the strategy. If filter is not nil, only the addresses in
+// it are ranked.
+func (p *Pingu) rank(s Strategy, filter func(string) bool) ([]string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var (
+		addrs []string
+		peers []*peer
+	)
+	for addr := range p.wl {
+		st, ok := p.peers[addr]
+		if !ok || st.health != Alive || (filter != nil && !filter(addr)) {
+			continue
+		}
+		addrs = append(addrs, addr)
+		peers = append(peers, st)
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("no alive pingu")
+	}
+	idx := make([]int, len(addrs))
+	for i := range idx {
+		idx[i] = i
+	}
+	switch s {
+	case PickRandom:
+		rand.Shuffle(len(idx), func(i, j int) { idx[i], idx[j] = idx[j], idx[i] })
+	case PickRoundRobin:
+		sort.Slice(idx, func(i, j int) bool { return addrs[idx[i]] < addrs[idx[j]] })
+		n := int(p.picked % uint64(len(idx)))
+		p.picked++
+		idx = append(idx[n:], idx[:n]...)
+	case PickLowestRTT:
+		// The pingus never measured go last.
+		sort.SliceStable(idx, func(i, j int) bool {
+			a, b := peers[idx[i]].rtt, peers[idx[j]].rtt
+			if a == 0 || b == 0 {
+				return b == 0 && a != 0
+			}
+			return a < b
+		})
+	case PickLeastLoaded:
+		// A weighted shuffle, each pingu keyed with u^(1/weight).
+		keys := make([]float64, len(idx))
+		for i, st := range peers {
+			load := st.load
+			if load < 0 {
+				load = 0
+			}
+			keys[i] = math.Pow(rand.Float64(), 1+load)
+		}
+		sort.Slice(idx, func(i, j int) bool { return keys[idx[i]] > keys[idx[j]] })
+	default:
+		return nil, fmt.Errorf("invalid strategy: %v", s)
+	}
+	ranked := make([]string, len(idx))
+	for i, j := range idx {
+		ranked[i] = addrs[j]
+	}
+	return ranked, nil
+}
+
+// Dialer dials the services of the alive pingus. It tries them in order of
+// preference with its strategy, and falls back to the next one if the dial
+// fails.
+type Dialer struct {
+	Pingu *Pingu
+	// Services maps the raw addresses of the pingus to the addresses of
+	// their services. The pingus not in it are not dialed.
+	Services map[string]string
+	// Strategy is PickRandom if 0.
+	Strategy Strategy
+	// Dialer dials the services.
+	Dialer net.Dialer
+}
+
+// Dial connects to the service of an alive pingu on the named network.
+func (d *Dialer) Dial(network string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network)
+}
+
+// DialContext connects to the service of an alive pingu on the named
+// network using the provided context.
+func (d *Dialer) DialContext(ctx context.Context, network string) (net.Conn, error) {
+	s := d.Strategy
+	if s == 0 {
+		s = PickRandom
+	}
+	ranked, err := d.Pingu.rank(s, func(addr string) bool {
+		_, ok := d.Services[addr]
+		return ok
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, addr := range ranked {
+		var conn net.Conn
+		conn, err = d.Dialer.DialContext(ctx, network, d.Services[addr])
+		if err == nil {
+			return conn, nil
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, err
+}
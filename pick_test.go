@@ -0,0 +1,131 @@
+package pingu_test
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/protocol-diver/pingu"
+)
+
+func newPickPingus(t *testing.T, addrs []string) []*pingu.Pingu {
+	pingus := make([]*pingu.Pingu, 0, len(addrs))
+	for _, addr := range addrs {
+		p, err := pingu.NewPingu(addr, nil)
+		if err != nil {
+			t.Fatalf("Pick NewPingu failure %v", err)
+		}
+		t.Cleanup(func() { p.Close() })
+		p.Start()
+		pingus = append(pingus, p)
+	}
+	for _, addr := range addrs[1:] {
+		pingus[0].RegisterWithRawAddr(addr)
+	}
+	if err := pingus[0].StartProbing(pingu.ProbeOptions{Interval: 10 * time.Millisecond, Timeout: 10 * time.Millisecond}); err != nil {
+		t.Fatalf("Pick StartProbing failure %v", err)
+	}
+	return pingus
+}
+
+func TestPick(t *testing.T) {
+	addrs := []string{"127.0.0.1:10190", "127.0.0.1:10191", "127.0.0.1:10192"}
+	pingus := newPickPingus(t, addrs)
+	p := pingus[0]
+	pingus[2].SetLoad(1000)
+	time.Sleep(100 * time.Millisecond)
+
+	if st, _ := p.PeerState(addrs[1]); st.RTT <= 0 || st.Load != 0 {
+		t.Fatalf("Pick invalid state: %+v", st)
+	}
+	if st, _ := p.PeerState(addrs[2]); st.Load != 1000 {
+		t.Fatalf("Pick invalid load got: %v, want: %v", st.Load, 1000)
+	}
+
+	if near := p.Nearest(1); len(near) != 1 || (near[0] != addrs[1] && near[0] != addrs[2]) {
+		t.Fatalf("Nearest invalid got: %v", near)
+	}
+	if rtt, err := p.EstimateRTT(addrs[0], addrs[1]); err != nil || rtt <= 0 {
+		t.Fatalf("EstimateRTT invalid got: %v, %v", rtt, err)
+	}
+	if _, err := p.EstimateRTT(addrs[0], "127.0.0.1:1"); err == nil {
+		t.Fatalf("EstimateRTT expected failure on unknown pingu")
+	}
+
+	a, _ := p.Pick(pingu.PickRoundRobin)
+	b, _ := p.Pick(pingu.PickRoundRobin)
+	c, _ := p.Pick(pingu.PickRoundRobin)
+	if a == b || a != c {
+		t.Fatalf("Pick invalid round-robin: %v, %v, %v", a, b, c)
+	}
+
+	picked := make(map[string]int)
+	for i := 0; i < 100; i++ {
+		addr, err := p.Pick(pingu.PickLeastLoaded)
+		if err != nil {
+			t.Fatalf("Pick failure %v", err)
+		}
+		picked[addr]++
+	}
+	if picked[addrs[1]] < 90 {
+		t.Fatalf("Pick invalid least-loaded got: %v", picked)
+	}
+
+	for _, s := range []pingu.Strategy{pingu.PickRandom, pingu.PickLowestRTT} {
+		if addr, err := p.Pick(s); err != nil || (addr != addrs[1] && addr != addrs[2]) {
+			t.Fatalf("Pick %v invalid got: %v, %v", s, addr, err)
+		}
+	}
+
+	pingus[1].Close()
+	pingus[2].Close()
+	time.Sleep(100 * time.Millisecond)
+	if _, err := p.Pick(pingu.PickRandom); err == nil {
+		t.Fatalf("Pick expected failure without alive pingu")
+	}
+}
+
+func TestDialer(t *testing.T) {
+	addrs := []string{"127.0.0.1:10193", "127.0.0.1:10194", "127.0.0.1:10195"}
+	pingus := newPickPingus(t, addrs)
+	time.Sleep(100 * time.Millisecond)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Dialer Listen failure %v", err)
+	}
+	defer l.Close()
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Dialer Listen failure %v", err)
+	}
+	closed.Close()
+
+	d := &pingu.Dialer{
+		Pingu: pingus[0],
+		Services: map[string]string{
+			addrs[1]: l.Addr().String(),
+			addrs[2]: closed.Addr().String(),
+		},
+		Strategy: pingu.PickRoundRobin,
+	}
+	// Either pingu is tried first, the refused one falls back.
+	for i := 0; i < 2; i++ {
+		conn, err := d.Dial("tcp")
+		if err != nil {
+			t.Fatalf("Dialer Dial failure %v", err)
+		}
+		if conn.RemoteAddr().String() != l.Addr().String() {
+			t.Fatalf("Dialer invalid remote got: %v, want: %v", conn.RemoteAddr(), l.Addr())
+		}
+		conn.Close()
+	}
+
+	// The dead pingu is not dialed even if its service is up.
+	pingus[1].Close()
+	time.Sleep(100 * time.Millisecond)
+	if conn, err := d.Dial("tcp"); err == nil {
+		conn.Close()
+		t.Fatalf("Dialer expected failure, dialed: %v", conn.RemoteAddr())
+	}
+}
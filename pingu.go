@@ -7,12 +7,15 @@
 package pingu
 
 import (
+	"errors"
 	"fmt"
 	"log"
+	"math/rand"
 	"net"
 	"net/netip"
 	"sync"
 	"sync/atomic"
+	"syscall"
 	"time"
 )
 
@@ -20,8 +23,6 @@ const (
 	pingType = 1 + iota
 	// NotificationType
 
-	maxPacketSize = 4
-
 	localhost   = "127.0.0.1"
 	defaultPort = 4874
 )
@@ -35,12 +36,66 @@ type Pingu struct {
 	// send a ping request self.
 	wl map[string]bool
 
-	// 'peers' mapping rawAddress to health status.
+	// 'peers' mapping rawAddress to peer state.
 	// The health status set when the ping-pong request completes
-	peers map[string]bool
+	peers map[string]*peer
+
+	// 'seqs' mapping rawAddress to the ping sequences of the registered
+	// pingus, see PeerStats. It's apart from 'peers', a ping doesn't make
+	// a pingu probed.
+	seqs map[string]*seqTracker
+
+	// 'self' is the raw address of this pingu.
+	self string
+
+	// 'incarnation' and 'rumors' are the state of the dissemination, see
+	// Config.Gossip.
+	incarnation uint32
+	rumors      map[string]*rumor
+
+	// 'tombstones' mapping reaped rawAddress to the time it could be
+	// registered by gossip again.
+	tombstones map[string]time.Time
+
+	subs     map[*Subscription]struct{}
+	watchers map[chan struct{}]struct{}
+
+	// 'checks' mapping name to the dead man's switch of a scheduled job.
+	checks map[string]*check
+
+	// 'grants' mapping name to the lease granted to the registered pingus.
+	grants map[string]*grant
+
+	// 'groups' mapping name to the group of pingus, see SetGroup.
+	groups map[string]*group
+	// 'derived' mapping name to the derived check, see SetDerivedCheck.
+	derived map[string]*derived
+	// 'labels' mapping raw address to the labels of the pingu, see SetLabels.
+	labels map[string][]string
+	// 'beatSources' mapping raw address to the sources allowed to beat for
+	// the pingu, see AllowBeatSource.
+	beatSources map[string][]string
+	// 'thresholds' mapping raw address or group name to the latency
+	// thresholds, see SetLatencyThresholds.
+	thresholds map[string]LatencyThresholds
 
 	recvPongs chan packet
 
+	// 'waiters' mapping nonce to the in-flight ping waiting for its pong.
+	waiters map[uint32]*waiter
+	nonce   uint32
+
+	// 'coord' is the Vivaldi coordinate of this pingu, see EstimateRTT.
+	coord *coordinate
+
+	// 'load' is reported to the pingus probing this one, see SetLoad.
+	load float64
+	// 'picked' counts the round-robin picks, see Pick.
+	picked uint64
+
+	// 'probing' is closed to stop the probe scheduler, nil if not running.
+	probing chan struct{}
+
 	isRun uint32
 	mu    sync.Mutex
 
@@ -68,13 +123,30 @@ func NewPingu(rawAddr string, cfg *Config) (*Pingu, error) {
 	if cfg.RecvBufferSize < 1 {
 		cfg.RecvBufferSize = 256
 	}
+	if cfg.MaxPacketSize < DefaultMaxPacketSize {
+		cfg.MaxPacketSize = DefaultMaxPacketSize
+	}
 	return &Pingu{
-		conn:      conn,
-		cfg:       cfg,
-		wl:        make(map[string]bool),
-		peers:     make(map[string]bool),
-		stop:      make(chan struct{}, 1),
-		recvPongs: make(chan packet, cfg.RecvBufferSize),
+		conn:       conn,
+		cfg:        cfg,
+		wl:         make(map[string]bool),
+		peers:      make(map[string]*peer),
+		seqs:       make(map[string]*seqTracker),
+		self:       conn.LocalAddr().String(),
+		rumors:     make(map[string]*rumor),
+		tombstones: make(map[string]time.Time),
+		subs:       make(map[*Subscription]struct{}),
+		watchers:   make(map[chan struct{}]struct{}),
+		checks:     make(map[string]*check),
+		grants:     make(map[string]*grant),
+		groups:     make(map[string]*group),
+		derived:    make(map[string]*derived),
+		labels:     make(map[string][]string),
+		thresholds: make(map[string]LatencyThresholds),
+		recvPongs:  make(chan packet, cfg.RecvBufferSize),
+		waiters:    make(map[uint32]*waiter),
+		nonce:      rand.Uint32(),
+		coord:      newCoordinate(),
 	}, nil
 }
 
@@ -84,7 +156,14 @@ func (p *Pingu) Start() {
 		return
 	}
 	atomic.StoreUint32(&p.isRun, 1)
-	go p.detectLoop()
+	p.stop = make(chan struct{})
+	go p.detectLoop(p.stop)
+	go p.dispatchLoop(p.stop)
+}
+
+// running reports whether the Pingu is started.
+func (p *Pingu) running() bool {
+	return atomic.LoadUint32(&p.isRun) == 1
 }
 
 // Stop stops the packet control loop. If you stop the Pingu, it
@@ -94,30 +173,33 @@ func (p *Pingu) Stop() {
 		return
 	}
 	// Stop the detectLoop first for initialize p.peers
-	p.stop <- struct{}{}
-	p.peers = make(map[string]bool)
+	close(p.stop)
+	p.mu.Lock()
+	p.resetPeers()
+	p.mu.Unlock()
 	atomic.StoreUint32(&p.isRun, 0)
 }
 
 // Close is close the UDP connection and close cancel channels.
 func (p *Pingu) Close(cancels ...chan struct{}) error {
 	p.Stop()
+	p.StopProbing()
 	for _, cancel := range cancels {
 		cancel <- struct{}{}
 	}
 	return p.conn.Close()
 }
 
-func (p *Pingu) detectLoop() {
+func (p *Pingu) detectLoop(stop chan struct{}) {
 	for {
 		select {
-		case <-p.stop:
+		case <-stop:
 			if p.cfg.Verbose {
 				log.Println("[pingu] recv close signal")
 			}
 			return
 		default:
-			b := make([]byte, maxPacketSize)
+			b := make([]byte, p.cfg.MaxPacketSize)
 			size, sender, err := p.conn.ReadFromUDP(b)
 			if size == 0 {
 				continue
@@ -129,24 +211,63 @@ func (p *Pingu) detectLoop() {
 				continue
 			}
 
-			go func() {
-				packet, err := parsePacket(b, sender)
-				if err != nil {
-					if p.cfg.Verbose {
-						log.Printf("[pingu] detected invalid protocol, reason : %v\n", err)
+			go p.handle(b[:size], sender, time.Now())
+		}
+	}
+}
+
+// handle processes the packet received from sender at recvAt.
+func (p *Pingu) handle(b []byte, sender *net.UDPAddr, recvAt time.Time) {
+	packet, err := parsePacket(b, sender)
+	if err != nil {
+		if p.cfg.Verbose {
+			log.Printf("[pingu] detected invalid protocol, reason : %v\n", err)
+		}
+		return
+	}
+	p.seen(sender.String(), packet.Kind())
+	p.recvCoord(sender.String(), packet.Header().Coord)
+	if p.cfg.Gossip {
+		p.merge(packet)
+	}
+	switch packet.Kind() {
+	case ping:
+		packet.(*pingPacket).recvAt = recvAt
+		go p.pong(sender, packet.(*pingPacket))
+	case pong:
+		packet.(*pongPacket).recvAt = recvAt
+		p.recvPongs <- packet
+	case beat:
+		p.recvBeat(packet.(*beatPacket))
+	default:
+		log.Printf("[pingu] detected invalid protocol: invalid packet type %v\n", packet.Kind())
+	}
+}
+
+// dispatchLoop hands received pongs to the pings waiting for their nonce.
+// A pong nobody waits for is dropped, so a late or duplicated pong can't be
+// taken as the answer of another ping.
+func (p *Pingu) dispatchLoop(stop chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			return
+		case r := <-p.recvPongs:
+			p.mu.Lock()
+			nonce := r.Header().Nonce
+			if w, ok := p.waiters[nonce]; ok && w.rawAddr == r.Sender().String() {
+				if !w.dups {
+					delete(p.waiters, nonce)
+					w.recv <- r
+				} else {
+					select {
+					case w.recv <- r:
+					default:
 					}
-					return
 				}
-				switch packet.Kind() {
-				case ping:
-					go p.pong([]*net.UDPAddr{sender})
-				case pong:
-					p.recvPongs <- packet
-				default:
-					log.Printf("[pingu] detected invalid protocol: invalid packet type %v\n", packet.Kind())
-					return
-				}
-			}()
+			}
+			p.ackSeq(r.Sender().String(), r.(*pongPacket).Seq, time.Now())
+			p.mu.Unlock()
 		}
 	}
 }
@@ -196,7 +317,8 @@ func (p *Pingu) UnregisterWithRawAddr(raw string) error {
 	return nil
 }
 
-// PingPong sends a 'ping' and waits for a 'pong' to be received.
+// PingPong sends a 'ping' and waits for a 'pong' to be received. The error
+// is ErrTimeout, ErrRefused, a SendError or ErrNotRunning.
 func (p *Pingu) PingPong(addr *net.UDPAddr, timeout time.Duration) error {
 	return p.pingpong(addr, timeout)
 }
@@ -213,6 +335,9 @@ func (p *Pingu) register(rawAddr string) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 	p.wl[rawAddr] = true
+	delete(p.tombstones, rawAddr)
+	p.evaluate()
+	p.notify()
 }
 
 func (p *Pingu) unregister(rawAddr string) {
@@ -222,31 +347,51 @@ func (p *Pingu) unregister(rawAddr string) {
 
 	// Avoid the case of staying `peer status is true` forever.
 	delete(p.peers, rawAddr)
+	delete(p.seqs, rawAddr)
+	p.evaluate()
+	p.notify()
 }
 
 func (p *Pingu) pingpong(addr *net.UDPAddr, timeout time.Duration) error {
+	if !p.running() {
+		return ErrNotRunning
+	}
 	rawAddr := addr.String()
 	res := p.ping([]*net.UDPAddr{addr}, timeout)
-	if !res[rawAddr] {
-		return fmt.Errorf("ping-pong failed ip: %v, timeout: %v", rawAddr, timeout)
+	if !res[rawAddr].alive {
+		_, err := res[rawAddr].failure()
+		return fmt.Errorf("ping-pong failed ip: %v, timeout: %v: %w", rawAddr, timeout, err)
 	}
 	return nil
 }
 
 // Send broadcast with ticker.
+//
+// Deprecated: BroadcastPingWithTicker pings every registered pingu in the same
+// burst. Use StartProbing, which spreads the probes over the interval.
 func (p *Pingu) BroadcastPingWithTicker(ticker time.Ticker, timeout time.Duration) chan struct{} {
 	cancel := make(chan struct{})
 	go func() {
 		for {
 			select {
 			case <-ticker.C:
+				// The ticker is always ready if the broadcast takes longer than
+				// its duration, don't let it win over the cancel.
+				select {
+				case <-cancel:
+					p.mu.Lock()
+					p.resetPeers()
+					p.mu.Unlock()
+					return
+				default:
+				}
 				// If 'timeout' greater than ticker duration, ticker wait broadcast done.
 				// Do not call broadcast by goroutine. If you use goroutine, will accumulate
 				// meaningless running goroutines.
 				p.broadcast(pingType, timeout)
 			case <-cancel:
 				p.mu.Lock()
-				p.peers = make(map[string]bool)
+				p.resetPeers()
 				p.mu.Unlock()
 				return
 			}
@@ -258,7 +403,8 @@ func (p *Pingu) BroadcastPingWithTicker(ticker time.Ticker, timeout time.Duratio
 func (p *Pingu) IsAlive(raw string) bool {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	return p.peers[raw]
+	st, ok := p.peers[raw]
+	return ok && st.health == Alive
 }
 
 // PingTable returns recently peer status map.
@@ -273,16 +419,20 @@ func (p *Pingu) PingTable() map[string]bool {
 // The caller must hold b.mu.
 func (p *Pingu) snapPingTable() (r map[string]bool) {
 	r = make(map[string]bool, len(p.peers))
-	for addr, health := range p.peers {
-		r[addr] = health
+	for addr, st := range p.peers {
+		r[addr] = st.health == Alive
 	}
 	return
 }
 
 func (p *Pingu) broadcast(t byte, timeout time.Duration) {
 	p.mu.Lock()
+	now := time.Now()
 	addrs := make([]*net.UDPAddr, 0, len(p.wl))
 	for target := range p.wl {
+		if !p.due(target, now) {
+			continue
+		}
 		addrs = append(addrs, mustAddrToUDPAddr(target))
 	}
 	p.mu.Unlock()
@@ -301,27 +451,126 @@ func (p *Pingu) broadcast(t byte, timeout time.Duration) {
 }
 
 // putState updates recently status map
-func (p *Pingu) putState(r map[string]bool) {
+func (p *Pingu) putState(r map[string]*probeResult) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	for addr, stat := range r {
-		if p.wl[addr] {
-			p.peers[addr] = stat
+	now := time.Now()
+	for addr, res := range r {
+		if !p.wl[addr] {
+			continue
+		}
+		if res.alive {
+			p.setHealth(addr, Alive)
+		} else {
+			p.setHealth(addr, Dead)
+			p.backOff(p.peers[addr], now)
+		}
+		st := p.peers[addr]
+		st.attempts = res.attempts
+		if !res.alive {
+			st.reason, st.err = res.failure()
+		}
+		if res.alive {
+			st.observeRTT(res.rtt)
+			p.observeLatency(addr, st, res.rtt, now)
+			p.observeCoord(st, res.rtt)
+			if res.clocked {
+				p.observeClock(addr, st, res.clock, now)
+			}
+			st.load = res.load
 		}
 	}
 }
 
-func (p *Pingu) ping(addrs []*net.UDPAddr, timeout time.Duration) map[string]bool {
-	result := make(map[string]bool, len(addrs))
+// probeResult is the result of a ping to a pingu.
+type probeResult struct {
+	alive bool
+	// refused reports whether the pingu refused, see Config.DetectRefused.
+	refused bool
+	// sendErr is the last error sending the pings.
+	sendErr error
+	// attempts is the number of pings sent, see Config.ProbeAttempts.
+	attempts int
+	pongs    int
+	// rtt is the round-trip time of the fastest pong, load the load it
+	// reported.
+	rtt  time.Duration
+	load float64
+	// clock is the clock sample of the lowest delay, if clocked.
+	clock   clockSample
+	clocked bool
+}
+
+// ping sends up to Config.ProbeAttempts pings to each address, spaced out,
+// and waits for their pongs until timeout. An address is alive once
+// Config.ProbeQuorum pongs are received, no more pings are sent to it then.
+func (p *Pingu) ping(addrs []*net.UDPAddr, timeout time.Duration) map[string]*probeResult {
+	attempts, quorum, spacing := p.cfg.probeAttempts(timeout)
+
+	result := make(map[string]*probeResult, len(addrs))
 	for _, addr := range addrs {
-		result[addr.String()] = false
-		if _, err := sendPacket(p.conn, addr, new(pingPacket)); err != nil {
-			log.Println(err)
-			continue
+		result[addr.String()] = new(probeResult)
+	}
+	recv := make(chan packet, len(addrs)*attempts)
+	var nonces []uint32
+	defer func() { p.unwait(nonces) }()
+	sentAt := make(map[uint32]time.Time, len(addrs)*attempts)
+
+	var conns map[string]*net.UDPConn
+	refused := make(chan string, len(addrs))
+	if p.cfg.DetectRefused {
+		conns = p.dialProbes(addrs, refused)
+		defer func() {
+			for _, conn := range conns {
+				conn.Close()
+			}
+		}()
+	}
+
+	sendAll := func() {
+		for _, addr := range addrs {
+			res := result[addr.String()]
+			if res.alive || res.refused {
+				continue
+			}
+			nonce := p.wait(addr, recv)
+			nonces = append(nonces, nonce)
+			now := time.Now()
+			sentAt[nonce] = now
+			p.mu.Lock()
+			seq := p.nextSeq(addr.String(), now)
+			p.mu.Unlock()
+			res.attempts++
+			ping := &pingPacket{header: header{Nonce: nonce}, Seq: seq}
+			var err error
+			if conn, ok := conns[addr.String()]; ok {
+				_, err = p.sendOn(conn, nil, ping)
+			} else {
+				_, err = p.send(addr, ping)
+			}
+			if err != nil {
+				if errors.Is(err, syscall.ECONNREFUSED) {
+					// Refused by an earlier ping on the connected socket.
+					select {
+					case refused <- addr.String():
+					default:
+					}
+					continue
+				}
+				res.sendErr = err
+				p.logSendError(err)
+			}
 		}
 	}
+	sendAll()
 
-	receiveCount := 0
+	var next <-chan time.Time
+	if attempts > 1 {
+		ticker := time.NewTicker(spacing)
+		defer ticker.Stop()
+		next = ticker.C
+	}
+	sent, receiveCount, refusedCount := 1, 0, 0
 
 	timer := time.NewTimer(timeout)
 	defer timer.Stop()
@@ -329,35 +578,135 @@ func (p *Pingu) ping(addrs []*net.UDPAddr, timeout time.Duration) map[string]boo
 		select {
 		case <-timer.C:
 			return result
-		case r := <-p.recvPongs:
-			result[r.Sender().String()] = true
+		case <-next:
+			sendAll()
+			if sent++; sent == attempts {
+				next = nil
+			}
+		case addr := <-refused:
+			res := result[addr]
+			if res.alive || res.refused {
+				continue
+			}
+			res.refused = true
+			if refusedCount++; receiveCount+refusedCount == len(addrs) {
+				return result
+			}
+		case r := <-recv:
+			res := result[r.Sender().String()]
+			res.pongs++
+			if rtt := time.Since(sentAt[r.Header().Nonce]); res.rtt == 0 || rtt < res.rtt {
+				res.rtt = rtt
+			}
+			pong := r.(*pongPacket)
+			res.load = pong.Load
+			if c, ok := measureClock(sentAt[pong.Nonce], pong); ok && (!res.clocked || c.delay < res.clock.delay) {
+				res.clock, res.clocked = c, true
+			}
+			if res.pongs != quorum {
+				continue
+			}
+			res.alive = true
 			receiveCount++
 
 			// early returns if receive all pongs before timeout reached
-			if receiveCount == len(addrs) {
+			if receiveCount+refusedCount == len(addrs) {
 				return result
 			}
 		}
 	}
 }
 
-func (p *Pingu) pong(addrs []*net.UDPAddr) {
-	for _, addr := range addrs {
-		go func(target *net.UDPAddr) {
-			if _, err := sendPacket(p.conn, target, new(pongPacket)); err != nil {
-				log.Println(err)
-				return
-			}
-		}(addr)
+// waiter is a ping waiting for its pong.
+type waiter struct {
+	rawAddr string
+	recv    chan packet
+	// dups keeps the waiter after the pong, so the duplicates are received
+	// too, as long as recv has room.
+	dups bool
+}
+
+// wait registers recv to receive the pong of a ping to addr. It returns the
+// nonce of the ping.
+func (p *Pingu) wait(addr *net.UDPAddr, recv chan packet) uint32 {
+	return p.addWaiter(&waiter{rawAddr: addr.String(), recv: recv})
+}
+
+func (p *Pingu) addWaiter(w *waiter) uint32 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.nonce++
+	for p.nonce == 0 || p.waiters[p.nonce] != nil {
+		p.nonce++
+	}
+	p.waiters[p.nonce] = w
+	return p.nonce
+}
+
+func (p *Pingu) unwait(nonces []uint32) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, nonce := range nonces {
+		delete(p.waiters, nonce)
+	}
+}
+
+// pong answers the ping with its nonce, sequence, timestamps and load, and
+// the lease if requested.
+func (p *Pingu) pong(addr *net.UDPAddr, ping *pingPacket) {
+	p.mu.Lock()
+	r := &pongPacket{header: header{Nonce: ping.Nonce}, Seq: ping.Seq, Load: p.load}
+	p.mu.Unlock()
+	r.Recv = ping.recvAt.UnixMicro()
+	// Pad the pong as the ping, see ProbePathMTU.
+	if ping.padded() {
+		r.padTo = ping.size
+	}
+	if ping.Lease != nil {
+		r.Lease = p.answerLease(addr.String(), ping.Lease)
+	}
+	r.Sent = time.Now().UnixMicro()
+	if _, err := p.send(addr, r); err != nil {
+		p.logSendError(err)
+	}
+}
+
+// request sends the ping and waits for its pong until timeout.
+func (p *Pingu) request(addr *net.UDPAddr, ping *pingPacket, timeout time.Duration) (*pongPacket, error) {
+	if !p.running() {
+		return nil, ErrNotRunning
+	}
+	recv := make(chan packet, 1)
+	ping.Nonce = p.wait(addr, recv)
+	defer p.unwait([]uint32{ping.Nonce})
+	if _, err := p.send(addr, ping); err != nil {
+		return nil, err
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case r := <-recv:
+		return r.(*pongPacket), nil
+	case <-timer.C:
+		return nil, fmt.Errorf("ping-pong failed ip: %v, timeout: %v: %w", addr, timeout, ErrTimeout)
 	}
 }
 
 func sendPacket(conn *net.UDPConn, addr *net.UDPAddr, p packet) (int, error) {
 	byt, err := suitableUnpack(p)
 	if err != nil {
-		return 0, err
+		return 0, sendError(conn, addr, err)
+	}
+	var n int
+	if addr == nil {
+		n, err = conn.Write(byt)
+	} else {
+		n, err = conn.WriteToUDP(byt, addr)
+	}
+	if err != nil {
+		return n, sendError(conn, addr, err)
 	}
-	return conn.WriteToUDP(byt, addr)
+	return n, nil
 }
 
 // [Benchmark]
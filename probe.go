@@ -0,0 +1,282 @@
+// Copyright (c) 2022, Seungbae Yu <dbadoy4874@gmail.com>
+// All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package pingu
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+	"net"
+	"time"
+)
+
+const defaultMaxOutstanding = 16
+
+// ProbeOptions configures the probe scheduler started by StartProbing.
+type ProbeOptions struct {
+	// Interval is the period in which every registered pingu is probed once,
+	// or the Targets of them.
+	Interval time.Duration
+
+	// Timeout is the time limit of send ping -> recv pong. It defaults to Interval.
+	Timeout time.Duration
+
+	// The probes of a period are spread evenly over the Interval. Jitter
+	// delays each probe by a random fraction of its slot, in [0, 1], so that
+	// pingus started together don't send their pings at the same instant.
+	Jitter float64
+
+	// RoundRobin walks a shuffled member list that is kept across periods and
+	// reshuffled after each full pass (SWIM style). Every pingu is then probed
+	// at a steady pace. Otherwise the order is random in each period.
+	RoundRobin bool
+
+	// Targets is the number of pingus probed per Interval, zero means all of
+	// them. With RoundRobin the targets are the next ones of the member list,
+	// otherwise a random subset. Enable Config.Gossip to learn the state of
+	// the pingus that are not probed from the others.
+	Targets int
+
+	// DetectionTime bounds the time to detect a dead pingu. The number of
+	// targets per Interval is raised so that the member list is walked,
+	// round robin, fast enough. It must be at least 2*Interval + Timeout.
+	DetectionTime time.Duration
+
+	// MaxOutstanding caps the number of probes waiting for a pong at once,
+	// default value : 16
+	MaxOutstanding int
+}
+
+func (o *ProbeOptions) validate() error {
+	if o.Interval <= 0 {
+		return fmt.Errorf("invalid probe interval: %v", o.Interval)
+	}
+	if o.Timeout < 0 {
+		return fmt.Errorf("invalid probe timeout: %v", o.Timeout)
+	}
+	if o.Jitter < 0 || o.Jitter > 1 {
+		return fmt.Errorf("invalid probe jitter: %v", o.Jitter)
+	}
+	if o.Targets < 0 {
+		return fmt.Errorf("invalid probe targets: %v", o.Targets)
+	}
+	if o.MaxOutstanding < 0 {
+		return fmt.Errorf("invalid probe max outstanding: %v", o.MaxOutstanding)
+	}
+	if o.Timeout == 0 {
+		o.Timeout = o.Interval
+	}
+	if o.MaxOutstanding == 0 {
+		o.MaxOutstanding = defaultMaxOutstanding
+	}
+	if o.DetectionTime != 0 {
+		if o.DetectionTime < 2*o.Interval+o.Timeout {
+			return fmt.Errorf("invalid probe detection time: %v", o.DetectionTime)
+		}
+		o.RoundRobin = true
+	}
+	return nil
+}
+
+// targets returns the number of pingus to probe per Interval out of n.
+//
+// A pass over the round robin list takes ceil(n/k) intervals, and a pingu
+// may be taken first in a pass and last in the next one. So the time between
+// two probes of a pingu is less than 2*ceil(n/k)*Interval.
+func (o *ProbeOptions) targets(n int) int {
+	k := n
+	if o.Targets > 0 && o.Targets < n {
+		k = o.Targets
+	}
+	if o.DetectionTime > 0 && n > 0 {
+		passes := int((o.DetectionTime - o.Timeout) / (2 * o.Interval))
+		if need := (n + passes - 1) / passes; need > k || o.Targets == 0 {
+			k = need
+		}
+	}
+	return k
+}
+
+// StartProbing starts the probe scheduler. Use StopProbing to stop it.
+func (p *Pingu) StartProbing(opts ProbeOptions) error {
+	if err := opts.validate(); err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.probing != nil {
+		return fmt.Errorf("probing already started")
+	}
+	p.probing = make(chan struct{})
+	go p.probeLoop(opts, p.probing)
+	return nil
+}
+
+// StopProbing stops the probe scheduler and clears the peer state map.
+func (p *Pingu) StopProbing() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.probing == nil {
+		return
+	}
+	close(p.probing)
+	p.probing = nil
+	p.resetPeers()
+}
+
+func (p *Pingu) probeLoop(opts ProbeOptions, cancel chan struct{}) {
+	var (
+		rng = rand.New(rand.NewSource(time.Now().UnixNano()))
+		rr  = &roundRobin{rng: rng}
+		sem = make(chan struct{}, opts.MaxOutstanding)
+	)
+	for {
+		start := time.Now()
+
+		members := p.Pingus()
+		n := opts.targets(len(members))
+		if opts.RoundRobin {
+			members = rr.take(members, n)
+		} else {
+			rng.Shuffle(len(members), func(i, j int) {
+				members[i], members[j] = members[j], members[i]
+			})
+			members = members[:n]
+		}
+		members = p.dueMembers(members, start)
+		if len(members) == 0 && p.cfg.Verbose {
+			log.Println("[pingu] there is no target")
+		}
+
+		slot := opts.Interval
+		if len(members) > 1 {
+			slot /= time.Duration(len(members))
+		}
+		for i, target := range members {
+			at := start.Add(time.Duration(i)*slot + time.Duration(rng.Float64()*opts.Jitter*float64(slot)))
+			if !sleepUntil(at, cancel) {
+				return
+			}
+			select {
+			case sem <- struct{}{}:
+			case <-cancel:
+				return
+			}
+			go func(target string) {
+				defer func() { <-sem }()
+				p.probe(target, opts.Timeout, cancel)
+			}(target)
+		}
+		if !sleepUntil(start.Add(opts.Interval), cancel) {
+			return
+		}
+	}
+}
+
+// probe pings a single pingu and stores the result, unless the scheduler
+// has been stopped in the meantime.
+func (p *Pingu) probe(rawAddr string, timeout time.Duration, cancel chan struct{}) {
+	addr, err := rawAddrToUDPAddr(rawAddr)
+	if err != nil {
+		return
+	}
+	res := p.ping([]*net.UDPAddr{addr}, timeout)
+	select {
+	case <-cancel:
+		return
+	default:
+	}
+	p.putState(res)
+}
+
+// dueMembers drops the pingus that are not due to be probed.
+func (p *Pingu) dueMembers(members []string, now time.Time) []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	res := members[:0]
+	for _, m := range members {
+		if p.due(m, now) {
+			res = append(res, m)
+		}
+	}
+	return res
+}
+
+// sleepUntil waits for t. It reports false if cancel is closed before.
+func sleepUntil(t time.Time, cancel chan struct{}) bool {
+	timer := time.NewTimer(time.Until(t))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-cancel:
+		return false
+	}
+}
+
+// roundRobin walks a shuffled member list. Members that join are inserted at
+// a random position of the list, and the list is reshuffled after each pass.
+type roundRobin struct {
+	rng   *rand.Rand
+	order []string
+	next  int
+}
+
+// take returns up to n members following the previous take.
+func (r *roundRobin) take(members []string, n int) []string {
+	r.sync(members)
+	if len(r.order) == 0 {
+		return nil
+	}
+	if n > len(r.order) {
+		n = len(r.order)
+	}
+	res := make([]string, 0, n)
+	for len(res) < n {
+		if r.next >= len(r.order) {
+			r.rng.Shuffle(len(r.order), func(i, j int) {
+				r.order[i], r.order[j] = r.order[j], r.order[i]
+			})
+			r.next = 0
+		}
+		res = append(res, r.order[r.next])
+		r.next++
+	}
+	return res
+}
+
+// sync drops the gone members from the list and inserts the new ones.
+func (r *roundRobin) sync(members []string) {
+	current := make(map[string]bool, len(members))
+	for _, m := range members {
+		current[m] = true
+	}
+	order := r.order[:0]
+	for i, m := range r.order {
+		if !current[m] {
+			if i < r.next {
+				r.next--
+			}
+			continue
+		}
+		delete(current, m)
+		order = append(order, m)
+	}
+	r.order = order
+	for _, m := range members {
+		if !current[m] {
+			continue
+		}
+		i := r.rng.Intn(len(r.order) + 1)
+		r.order = append(r.order, "")
+		copy(r.order[i+1:], r.order[i:])
+		r.order[i] = m
+		if i < r.next {
+			r.next++
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package pingu_test
+
+import (
+	"encoding/json"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/protocol-diver/pingu"
+)
+
+func TestStartProbing(t *testing.T) {
+	pingu1, err := pingu.NewPingu("127.0.0.1:9290", nil)
+	if err != nil {
+		t.Fatalf("StartProbing NewPingu failure %v", err)
+	}
+	defer pingu1.Close()
+	pingu2, err := pingu.NewPingu("127.0.0.1:9291", nil)
+	if err != nil {
+		t.Fatalf("StartProbing NewPingu failure %v", err)
+	}
+	defer pingu2.Close()
+
+	pingu1.Start()
+	pingu2.Start()
+
+	pingu1.RegisterWithRawAddr("127.0.0.1:9291")
+	pingu1.RegisterWithRawAddr("127.0.0.1:9292")
+
+	if err := pingu1.StartProbing(pingu.ProbeOptions{Interval: 0}); err == nil {
+		t.Fatalf("StartProbing failure: accepted zero interval")
+	}
+	opts := pingu.ProbeOptions{
+		Interval:       20 * time.Millisecond,
+		Timeout:        10 * time.Millisecond,
+		Jitter:         0.5,
+		RoundRobin:     true,
+		MaxOutstanding: 1,
+	}
+	if err := pingu1.StartProbing(opts); err != nil {
+		t.Fatalf("StartProbing failure got: %v", err)
+	}
+	if err := pingu1.StartProbing(opts); err == nil {
+		t.Fatalf("StartProbing failure: started twice")
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	table := pingu1.PingTable()
+	if !table["127.0.0.1:9291"] {
+		t.Fatalf("StartProbing invalid result: %v", table)
+	}
+	if _, ok := table["127.0.0.1:9292"]; !ok || table["127.0.0.1:9292"] {
+		t.Fatalf("StartProbing invalid result: %v", table)
+	}
+
+	pingu1.StopProbing()
+	if table := pingu1.PingTable(); len(table) != 0 {
+		t.Fatalf("StopProbing invalid result length: %v, want: %v", len(table), 0)
+	}
+}
+
+func TestProbeAttempts(t *testing.T) {
+	cfg := new(pingu.Config)
+	cfg.Default()
+	cfg.ProbeAttempts = 3
+	cfg.ProbeQuorum = 1
+	cfg.ProbeSpacing = 10 * time.Millisecond
+	pingu1, err := pingu.NewPingu("127.0.0.1:9294", cfg)
+	if err != nil {
+		t.Fatalf("ProbeAttempts NewPingu failure %v", err)
+	}
+	defer pingu1.Close()
+	pingu1.Start()
+
+	// The lossy pingu answers every other ping.
+	lossy, err := net.ListenUDP("udp", net.UDPAddrFromAddrPort(netip.MustParseAddrPort("127.0.0.1:9295")))
+	if err != nil {
+		t.Fatalf("ProbeAttempts ListenUDP failure %v", err)
+	}
+	defer lossy.Close()
+	go func() {
+		b := make([]byte, 512)
+		for i := 0; ; i++ {
+			n, sender, err := lossy.ReadFromUDP(b)
+			if err != nil {
+				return
+			}
+			if i%2 == 0 {
+				continue
+			}
+			var ping map[string]interface{}
+			if err := json.Unmarshal(b[2:n], &ping); err != nil {
+				continue
+			}
+			pong, _ := json.Marshal(map[string]interface{}{"n": ping["n"]})
+			lossy.WriteToUDP(append([]byte{1, byte(len(pong))}, pong...), sender)
+		}
+	}()
+
+	pingu1.RegisterWithRawAddr("127.0.0.1:9295")
+	err = pingu1.StartProbing(pingu.ProbeOptions{Interval: 50 * time.Millisecond, Timeout: 40 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("ProbeAttempts StartProbing failure %v", err)
+	}
+	time.Sleep(120 * time.Millisecond)
+
+	st, ok := pingu1.PeerState("127.0.0.1:9295")
+	if !ok || st.Health != pingu.Alive || st.Attempts != 2 {
+		t.Fatalf("ProbeAttempts invalid state: %+v", st)
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright (c) 2022, Seungbae Yu <dbadoy4874@gmail.com>
+// All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package pingu
+
+import "time"
+
+// Tombstones returns the reaped pingus's raw addresses, mapping to the time
+// they could be registered by gossip again.
+func (p *Pingu) Tombstones() map[string]time.Time {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	r := make(map[string]time.Time, len(p.tombstones))
+	for addr, until := range p.tombstones {
+		if now.Before(until) {
+			r[addr] = until
+		}
+	}
+	return r
+}
+
+// scheduleReap reaps the pingu when it has been dead for Config.ReapAfter.
+//
+// The caller must hold p.mu.
+func (p *Pingu) scheduleReap(rawAddr string, st *peer) {
+	if p.cfg.ReapAfter <= 0 {
+		return
+	}
+	since := st.deadSince
+	time.AfterFunc(p.cfg.ReapAfter, func() {
+		p.reap(rawAddr, st, since)
+	})
+}
+
+// reap unregisters the pingu, unless it came back to life since.
+func (p *Pingu) reap(rawAddr string, st *peer, since time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.peers[rawAddr] != st || st.health != Dead || !st.deadSince.Equal(since) {
+		return
+	}
+	now := time.Now()
+	delete(p.wl, rawAddr)
+	delete(p.peers, rawAddr)
+	delete(p.seqs, rawAddr)
+	delete(p.rumors, rawAddr)
+	p.evaluate()
+
+	ttl := p.cfg.TombstoneTTL
+	if ttl <= 0 {
+		ttl = p.cfg.ReapAfter
+	}
+	for addr, until := range p.tombstones {
+		if !now.Before(until) {
+			delete(p.tombstones, addr)
+		}
+	}
+	p.tombstones[rawAddr] = now.Add(ttl)
+	p.emit(Event{Type: EventReaped, Addr: rawAddr, Time: now})
+}
+
+// buried reports whether the pingu has been reaped recently.
+//
+// The caller must hold p.mu.
+func (p *Pingu) buried(rawAddr string) bool {
+	until, ok := p.tombstones[rawAddr]
+	return ok && time.Now().Before(until)
+}
@@ -0,0 +1,61 @@
+// Copyright (c) 2022, Seungbae Yu <dbadoy4874@gmail.com>
+// All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package pingu
+
+import (
+	"errors"
+	"log"
+	"net"
+	"syscall"
+	"time"
+)
+
+// dialProbes opens a UDP socket connected to each address for the pings of
+// a probe, see Config.DetectRefused. The pongs arrive on the sockets and are
+// handled as the others. The raw address of a pingu that refused is sent on
+// refused. The sockets must be closed by the caller.
+func (p *Pingu) dialProbes(addrs []*net.UDPAddr, refused chan<- string) map[string]*net.UDPConn {
+	var laddr *net.UDPAddr
+	if local, ok := p.conn.LocalAddr().(*net.UDPAddr); ok {
+		laddr = &net.UDPAddr{IP: local.IP, Zone: local.Zone}
+	}
+	conns := make(map[string]*net.UDPConn, len(addrs))
+	for _, addr := range addrs {
+		conn, err := net.DialUDP("udp", laddr, addr)
+		if err != nil {
+			// Pinged on the listening socket then.
+			if p.cfg.Verbose {
+				log.Printf("[pingu] DialUDP error %v\n", err)
+			}
+			continue
+		}
+		conns[addr.String()] = conn
+		go p.readProbe(conn, addr, refused)
+	}
+	return conns
+}
+
+// readProbe reads the pongs on the connected socket until it's closed.
+func (p *Pingu) readProbe(conn *net.UDPConn, addr *net.UDPAddr, refused chan<- string) {
+	for {
+		b := make([]byte, p.cfg.MaxPacketSize)
+		size, err := conn.Read(b)
+		if err != nil {
+			if !errors.Is(err, syscall.ECONNREFUSED) {
+				return
+			}
+			select {
+			case refused <- addr.String():
+			default:
+			}
+			continue
+		}
+		if size > 0 {
+			go p.handle(b[:size], addr, time.Now())
+		}
+	}
+}
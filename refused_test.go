@@ -0,0 +1,86 @@
+package pingu_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/protocol-diver/pingu"
+)
+
+func TestDetectRefused(t *testing.T) {
+	addrs := []string{"127.0.0.1:11190", "127.0.0.1:11191", "127.0.0.1:11192"}
+	p, err := pingu.NewPingu(addrs[0], &pingu.Config{DetectRefused: true})
+	if err != nil {
+		t.Fatalf("DetectRefused NewPingu failure %v", err)
+	}
+	defer p.Close()
+	p.Start()
+	other, err := pingu.NewPingu(addrs[1], nil)
+	if err != nil {
+		t.Fatalf("DetectRefused NewPingu failure %v", err)
+	}
+	defer other.Close()
+	other.Start()
+
+	// The pongs come back on the connected socket.
+	if err := p.PingPongWithRawAddr(addrs[1], time.Second); err != nil {
+		t.Fatalf("PingPong failure %v", err)
+	}
+
+	// Nothing listens on the port, the probe fails at once.
+	start := time.Now()
+	if err := p.PingPongWithRawAddr(addrs[2], time.Second); err == nil {
+		t.Fatalf("PingPong expected failure on refused pingu")
+	}
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Fatalf("PingPong invalid duration got: %v, want: under %v", d, 500*time.Millisecond)
+	}
+
+	p.RegisterWithRawAddr(addrs[1])
+	p.RegisterWithRawAddr(addrs[2])
+	if err := p.StartProbing(pingu.ProbeOptions{Interval: 10 * time.Millisecond, Timeout: 20 * time.Millisecond}); err != nil {
+		t.Fatalf("DetectRefused StartProbing failure %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if st, _ := p.PeerState(addrs[1]); st.Health != pingu.Alive || st.RTT == 0 {
+		t.Fatalf("PeerState invalid state got: %+v, want: alive", st)
+	}
+	if st, _ := p.PeerState(addrs[2]); st.Health != pingu.Dead || st.Reason != pingu.ReasonRefused {
+		t.Fatalf("PeerState invalid reason got: %v, want: %v", st.Reason, pingu.ReasonRefused)
+	}
+
+	// Without the option, the probe just times out.
+	q, err := pingu.NewPingu("127.0.0.1:11193", nil)
+	if err != nil {
+		t.Fatalf("DetectRefused NewPingu failure %v", err)
+	}
+	defer q.Close()
+	q.Start()
+	q.RegisterWithRawAddr(addrs[2])
+	if err := q.StartProbing(pingu.ProbeOptions{Interval: 10 * time.Millisecond, Timeout: 20 * time.Millisecond}); err != nil {
+		t.Fatalf("DetectRefused StartProbing failure %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if st, _ := q.PeerState(addrs[2]); st.Health != pingu.Dead || st.Reason != pingu.ReasonTimeout {
+		t.Fatalf("PeerState invalid reason got: %v, want: %v", st.Reason, pingu.ReasonTimeout)
+	}
+}
+
+func TestDetectRefusedAttempts(t *testing.T) {
+	// The later pings may get the refusal of the first one on send.
+	p, err := pingu.NewPingu("127.0.0.1:11194", &pingu.Config{DetectRefused: true, ProbeAttempts: 4, ProbeSpacing: time.Millisecond})
+	if err != nil {
+		t.Fatalf("DetectRefused NewPingu failure %v", err)
+	}
+	defer p.Close()
+	p.Start()
+	for i := 0; i < 5; i++ {
+		start := time.Now()
+		if err := p.PingPongWithRawAddr("127.0.0.1:11195", time.Second); err == nil {
+			t.Fatalf("PingPong expected failure on refused pingu")
+		}
+		if d := time.Since(start); d > 500*time.Millisecond {
+			t.Fatalf("PingPong invalid duration got: %v, want: under %v", d, 500*time.Millisecond)
+		}
+	}
+}
@@ -0,0 +1,222 @@
+// Copyright (c) 2022, Seungbae Yu <dbadoy4874@gmail.com>
+// All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package pingu
+
+import (
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultVirtualNodes is the number of the points of a pingu on a Ring.
+	DefaultVirtualNodes = 64
+	// DefaultReplicas is the number of the pingus owning a key of a Ring.
+	DefaultReplicas = 1
+)
+
+// RingOptions configures a Ring.
+type RingOptions struct {
+	// VirtualNodes is the number of the points of each pingu on the ring,
+	// DefaultVirtualNodes if 0. More points spread the keys more evenly.
+	VirtualNodes int
+	// Replicas is the number of the pingus owning each key, DefaultReplicas
+	// if 0.
+	Replicas int
+}
+
+// vnode is a point of a pingu on the ring.
+type vnode struct {
+	hash uint64
+	addr string
+}
+
+// Ring is a consistent hash ring of this pingu and the registered pingus. A
+// key is owned by the first alive pingus found clockwise from its hash, so
+// when a pingu dies, only its keys move to the next ones.
+type Ring struct {
+	p    *Pingu
+	opts RingOptions
+
+	mu     sync.Mutex
+	vnodes []vnode
+	// owners are the owners of the keys up to each vnode.
+	owners [][]string
+
+	cancel chan struct{}
+	once   sync.Once
+}
+
+// NewRing returns a Ring that follows the registrations and the health
+// changes. Use Ring.Stop to stop it.
+func (p *Pingu) NewRing(opts RingOptions) *Ring {
+	if opts.VirtualNodes <= 0 {
+		opts.VirtualNodes = DefaultVirtualNodes
+	}
+	if opts.Replicas <= 0 {
+		opts.Replicas = DefaultReplicas
+	}
+	r := &Ring{p: p, opts: opts, cancel: make(chan struct{})}
+	changed := p.watch()
+	r.update()
+	go r.loop(changed)
+	return r
+}
+
+// Lookup returns the raw addresses of the alive pingus owning the key, the
+// primary first. It returns less than RingOptions.Replicas addresses if
+// there are not enough alive pingus.
+func (r *Ring) Lookup(key string) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), ownersAt(r.vnodes, r.owners, ringHash(key))...)
+}
+
+// Stop stops following the changes.
+func (r *Ring) Stop() {
+	r.once.Do(func() {
+		close(r.cancel)
+	})
+}
+
+func (r *Ring) loop(changed chan struct{}) {
+	defer r.p.unwatch(changed)
+	for {
+		select {
+		case <-changed:
+			r.update()
+		case <-r.cancel:
+			return
+		}
+	}
+}
+
+// update rebuilds the ring and sends EventOwnershipMoved for the pingus that
+// gained or lost keys.
+func (r *Ring) update() {
+	r.p.mu.Lock()
+	defer r.p.mu.Unlock()
+
+	alive := map[string]bool{r.p.self: true}
+	members := []string{r.p.self}
+	for addr := range r.p.wl {
+		if addr == r.p.self {
+			continue
+		}
+		members = append(members, addr)
+		if st, ok := r.p.peers[addr]; ok && st.health == Alive {
+			alive[addr] = true
+		}
+	}
+
+	vnodes := make([]vnode, 0, len(members)*r.opts.VirtualNodes)
+	for _, addr := range members {
+		for i := 0; i < r.opts.VirtualNodes; i++ {
+			vnodes = append(vnodes, vnode{ringHash(addr + "#" + strconv.Itoa(i)), addr})
+		}
+	}
+	sort.Slice(vnodes, func(i, j int) bool {
+		if vnodes[i].hash != vnodes[j].hash {
+			return vnodes[i].hash < vnodes[j].hash
+		}
+		return vnodes[i].addr < vnodes[j].addr
+	})
+	owners := make([][]string, len(vnodes))
+	for i := range vnodes {
+		owners[i] = ownersFrom(vnodes, alive, i, r.opts.Replicas)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	old, oldOwners := r.vnodes, r.owners
+	r.vnodes, r.owners = vnodes, owners
+	if old == nil {
+		return
+	}
+
+	// The keys between two vnodes of either ring have the same owners.
+	moved := make(map[string]bool)
+	for _, ring := range [][]vnode{old, vnodes} {
+		for _, v := range ring {
+			a := ownersAt(old, oldOwners, v.hash)
+			b := ownersAt(vnodes, owners, v.hash)
+			for _, addr := range symmetricDiff(a, b) {
+				moved[addr] = true
+			}
+		}
+	}
+	now := time.Now()
+	for addr := range moved {
+		r.p.emit(Event{Type: EventOwnershipMoved, Addr: addr, Time: now})
+	}
+}
+
+// ownersFrom walks the ring clockwise from the vnode i and returns the first
+// n distinct alive pingus.
+func ownersFrom(vnodes []vnode, alive map[string]bool, i, n int) []string {
+	owners := make([]string, 0, n)
+	for j := 0; j < len(vnodes) && len(owners) < n; j++ {
+		addr := vnodes[(i+j)%len(vnodes)].addr
+		if !alive[addr] || contains(owners, addr) {
+			continue
+		}
+		owners = append(owners, addr)
+	}
+	return owners
+}
+
+// ownersAt returns the owners of the keys hashed to h.
+func ownersAt(vnodes []vnode, owners [][]string, h uint64) []string {
+	if len(vnodes) == 0 {
+		return nil
+	}
+	i := sort.Search(len(vnodes), func(i int) bool {
+		return vnodes[i].hash >= h
+	})
+	return owners[i%len(vnodes)]
+}
+
+// ringHash hashes s to a point on the ring. FNV alone keeps the similar
+// strings close, the finalizer of MurmurHash3 spreads them.
+func ringHash(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
+
+func contains(s []string, v string) bool {
+	for _, e := range s {
+		if e == v {
+			return true
+		}
+	}
+	return false
+}
+
+// symmetricDiff returns the elements in only one of a and b.
+func symmetricDiff(a, b []string) []string {
+	var r []string
+	for _, v := range a {
+		if !contains(b, v) {
+			r = append(r, v)
+		}
+	}
+	for _, v := range b {
+		if !contains(a, v) {
+			r = append(r, v)
+		}
+	}
+	return r
+}
@@ -0,0 +1,78 @@
+package pingu_test
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/protocol-diver/pingu"
+)
+
+func TestRing(t *testing.T) {
+	addrs := []string{"127.0.0.1:10090", "127.0.0.1:10091", "127.0.0.1:10092"}
+	pingus := make([]*pingu.Pingu, 0, len(addrs))
+	for _, addr := range addrs {
+		p, err := pingu.NewPingu(addr, nil)
+		if err != nil {
+			t.Fatalf("Ring NewPingu failure %v", err)
+		}
+		defer p.Close()
+		p.Start()
+		pingus = append(pingus, p)
+	}
+	p := pingus[0]
+	p.RegisterWithRawAddr(addrs[1])
+	p.RegisterWithRawAddr(addrs[2])
+	if err := p.StartProbing(pingu.ProbeOptions{Interval: 10 * time.Millisecond, Timeout: 10 * time.Millisecond}); err != nil {
+		t.Fatalf("Ring StartProbing failure %v", err)
+	}
+	r := p.NewRing(pingu.RingOptions{Replicas: 2})
+	defer r.Stop()
+	time.Sleep(100 * time.Millisecond)
+
+	owned := make(map[string]int)
+	for i := 0; i < 300; i++ {
+		owners := r.Lookup(strconv.Itoa(i))
+		if len(owners) != 2 || owners[0] == owners[1] {
+			t.Fatalf("Ring invalid owners: %v", owners)
+		}
+		owned[owners[0]]++
+	}
+	for _, addr := range addrs {
+		if owned[addr] < 50 {
+			t.Fatalf("Ring uneven keys got: %v", owned)
+		}
+	}
+
+	sub := p.Subscribe(16)
+	defer sub.Unsubscribe()
+	pingus[2].Close()
+	time.Sleep(100 * time.Millisecond)
+	for i := 0; i < 300; i++ {
+		owners := r.Lookup(strconv.Itoa(i))
+		if len(owners) != 2 {
+			t.Fatalf("Ring invalid owners: %v", owners)
+		}
+		for _, addr := range owners {
+			if addr == addrs[2] {
+				t.Fatalf("Ring dead owner: %v", owners)
+			}
+		}
+	}
+	moved := make(map[string]bool)
+	for len(sub.Events()) != 0 {
+		if e := <-sub.Events(); e.Type == pingu.EventOwnershipMoved {
+			moved[e.Addr] = true
+		}
+	}
+	if !moved[addrs[2]] {
+		t.Fatalf("Ring missing moved event got: %v", moved)
+	}
+
+	// The only alive pingu owns everything.
+	pingus[1].Close()
+	time.Sleep(100 * time.Millisecond)
+	if owners := r.Lookup("key"); len(owners) != 1 || owners[0] != addrs[0] {
+		t.Fatalf("Ring invalid owners: %v", owners)
+	}
+}
@@ -0,0 +1,343 @@
+// Copyright (c) 2022, Seungbae Yu <dbadoy4874@gmail.com>
+// All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package pingu
+
+import (
+	"fmt"
+	"time"
+)
+
+const defaultBackoffCeiling = 64
+
+// Health is the health status of a pingu.
+type Health uint8
+
+const (
+	Alive Health = 1 + iota
+	Dead
+)
+
+func (h Health) String() string {
+	switch h {
+	case Alive:
+		return "alive"
+	case Dead:
+		return "dead"
+	default:
+		return fmt.Sprintf("health(%d)", h)
+	}
+}
+
+// Reason is why a probe failed.
+type Reason uint8
+
+const (
+	// ReasonTimeout is a probe that got no answer, the host or the network
+	// may be down.
+	ReasonTimeout Reason = 1 + iota
+	// ReasonRefused is a probe refused by the host, the pingu is not
+	// running, see Config.DetectRefused.
+	ReasonRefused
+	// ReasonSendFailed is a probe whose pings couldn't be sent.
+	ReasonSendFailed
+)
+
+func (r Reason) String() string {
+	switch r {
+	case ReasonTimeout:
+		return "timeout"
+	case ReasonRefused:
+		return "refused"
+	case ReasonSendFailed:
+		return "send failed"
+	default:
+		return fmt.Sprintf("reason(%d)", r)
+	}
+}
+
+// peer is the state of a registered pingu.
+type peer struct {
+	health Health
+
+	// incarnation is the latest incarnation of the pingu known, see
+	// Config.Gossip.
+	incarnation uint32
+
+	// deadSince is the time the pingu became dead.
+	deadSince time.Time
+
+	// The pingu is not probed before nextProbe while dead, see
+	// Config.DeadBackoff.
+	backoff   time.Duration
+	nextProbe time.Time
+
+	// attempts is the number of pings the last probe sent.
+	attempts int
+	// reason is why the last failed probe failed, err its error.
+	reason Reason
+	err    error
+
+	// lastSeen is the time of the last packet from the pingu, lastPing of
+	// the last ping.
+	lastSeen time.Time
+	lastPing time.Time
+
+	// beatInterval is the declared interval of a pingu in push mode, see
+	// Beater. beatSeq identifies the last beat for its timeout.
+	beatInterval time.Duration
+	beatTimer    *time.Timer
+	beatSeq      uint64
+
+	// rtt is the smoothed round-trip time, load the last reported load.
+	rtt  time.Duration
+	load float64
+
+	// window counts the recent RTTs, p95 is their 95th percentile, see
+	// SetLatencyThresholds.
+	window  *rttWindow
+	p95     time.Duration
+	latency Latency
+
+	// hist are the RTT histograms, see PeerStats.
+	hist *rttHistograms
+
+	// clock are the recent clock samples, see PeerState.ClockOffset.
+	clock *clockFilter
+	// coord is the last Vivaldi coordinate received, see EstimateRTT.
+	coord *coordinate
+	// pathMTU is the result of the last ProbePathMTU.
+	pathMTU int
+}
+
+// PeerState is the state of a registered pingu.
+type PeerState struct {
+	Health Health
+	// DeadSince is the time the pingu became dead, zero if alive.
+	DeadSince time.Time
+	// Attempts is the number of pings the last probe needed, see
+	// Config.ProbeAttempts. It's a sign of a lossy link if above
+	// Config.ProbeQuorum.
+	Attempts int
+	// Reason is why the last failed probe failed, zero if none did, and
+	// LastError its error: ErrTimeout, ErrRefused or a SendError.
+	Reason    Reason
+	LastError error
+	// LastSeen is the time of the last packet received from the pingu.
+	LastSeen time.Time
+	// BeatInterval is the declared interval of the pingu if it's in push
+	// mode, see Beater.
+	BeatInterval time.Duration
+	// RTT is the smoothed round-trip time of the pings, zero if unknown.
+	RTT time.Duration
+	// Load is the last load reported by the pingu, see SetLoad.
+	Load float64
+	// Labels are the labels of the pingu, see SetLabels.
+	Labels []string
+	// Latency is the latency level of the pingu by P95, the 95th percentile
+	// of its recent RTTs, see SetLatencyThresholds.
+	Latency Latency
+	P95     time.Duration
+	// ClockOffset is the estimated offset of the clock of the pingu from
+	// ours, positive if ahead, measured by the pings with ClockDelay round
+	// trip, see Config.MaxClockSkew.
+	ClockOffset time.Duration
+	ClockDelay  time.Duration
+	// PathMTU is the largest packet that made the round trip, zero if not
+	// probed, see ProbePathMTU.
+	PathMTU int
+}
+
+// Degraded reports whether the pingu is alive but above a latency threshold.
+func (s PeerState) Degraded() bool {
+	return s.Health == Alive && s.Latency > LatencyNormal
+}
+
+func (st *peer) snapshot(labels []string) PeerState {
+	s := PeerState{
+		Health:       st.health,
+		DeadSince:    st.deadSince,
+		Attempts:     st.attempts,
+		Reason:       st.reason,
+		LastError:    st.err,
+		LastSeen:     st.lastSeen,
+		BeatInterval: st.beatInterval,
+		RTT:          st.rtt,
+		Load:         st.load,
+		Labels:       append([]string(nil), labels...),
+		Latency:      st.latency,
+		P95:          st.p95,
+		PathMTU:      st.pathMTU,
+	}
+	if st.clock != nil {
+		b := st.clock.best()
+		s.ClockOffset, s.ClockDelay = b.offset, b.delay
+	}
+	return s
+}
+
+// PeerState returns the state of the pingu, false if it's not probed yet.
+func (p *Pingu) PeerState(raw string) (PeerState, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	st, ok := p.peers[raw]
+	if !ok {
+		return PeerState{}, false
+	}
+	return st.snapshot(p.labels[raw]), true
+}
+
+// PeerStates returns the state of the probed pingus.
+func (p *Pingu) PeerStates() map[string]PeerState {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	r := make(map[string]PeerState, len(p.peers))
+	for addr, st := range p.peers {
+		r[addr] = st.snapshot(p.labels[addr])
+	}
+	return r
+}
+
+// SetLabels sets the labels of the pingu at raw, the names the health
+// expressions refer to it by, see SetDerivedCheck.
+func (p *Pingu) SetLabels(raw string, labels ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(labels) == 0 {
+		delete(p.labels, raw)
+	} else {
+		p.labels[raw] = append([]string(nil), labels...)
+	}
+	p.evalDerived()
+}
+
+// setHealth updates the health of the pingu. If changed, it's spread and
+// the event is sent. It reports whether the health changed.
+//
+// The caller must hold p.mu.
+func (p *Pingu) setHealth(rawAddr string, h Health) bool {
+	st := p.peer(rawAddr)
+	if st.health == h {
+		return false
+	}
+	now := time.Now()
+	st.health = h
+	p.rumor(rawAddr, st)
+	switch h {
+	case Alive:
+		st.deadSince = time.Time{}
+		p.emit(Event{Type: EventAlive, Addr: rawAddr, Time: now})
+	case Dead:
+		st.deadSince = now
+		st.window, st.p95, st.latency = nil, 0, LatencyNormal
+		p.scheduleReap(rawAddr, st)
+		p.emit(Event{Type: EventDead, Addr: rawAddr, Time: now})
+	}
+	p.evaluate()
+	return true
+}
+
+// observeRTT smooths the round-trip time like TCP does, 1/8 of the new
+// sample.
+func (st *peer) observeRTT(rtt time.Duration) {
+	if rtt <= 0 {
+		return
+	}
+	if st.rtt == 0 {
+		st.rtt = rtt
+		return
+	}
+	st.rtt += (rtt - st.rtt) / 8
+}
+
+// resetPeers clears the peer state map.
+//
+// The caller must hold p.mu.
+func (p *Pingu) resetPeers() {
+	p.peers = make(map[string]*peer)
+	p.seqs = make(map[string]*seqTracker)
+	p.evaluate()
+	p.notify()
+}
+
+// peer returns the state of the pingu, creating it if not exist.
+//
+// The caller must hold p.mu.
+func (p *Pingu) peer(rawAddr string) *peer {
+	st, ok := p.peers[rawAddr]
+	if !ok {
+		st = &peer{latency: LatencyNormal}
+		p.peers[rawAddr] = st
+	}
+	return st
+}
+
+// backOff delays the next probe of the dead pingu.
+//
+// The caller must hold p.mu.
+func (p *Pingu) backOff(st *peer, now time.Time) {
+	if p.cfg.DeadBackoff <= 0 {
+		return
+	}
+	ceiling := p.cfg.DeadBackoffMax
+	if ceiling <= 0 {
+		ceiling = defaultBackoffCeiling * p.cfg.DeadBackoff
+	}
+	if st.backoff == 0 {
+		st.backoff = p.cfg.DeadBackoff
+	} else {
+		st.backoff *= 2
+	}
+	if st.backoff > ceiling {
+		st.backoff = ceiling
+	}
+	st.nextProbe = now.Add(st.backoff)
+}
+
+// seen records a packet from the pingu. Any packet from it is a sign of
+// life, it resets the backoff, and marks it alive if Config.PassiveLiveness
+// is enabled.
+func (p *Pingu) seen(rawAddr string, kind byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	passive := p.cfg.PassiveLiveness > 0 && p.wl[rawAddr]
+	st, ok := p.peers[rawAddr]
+	if !ok {
+		if !passive {
+			return
+		}
+		st = p.peer(rawAddr)
+	}
+	now := time.Now()
+	st.backoff = 0
+	st.nextProbe = time.Time{}
+	st.lastSeen = now
+	if kind == ping {
+		st.lastPing = now
+	}
+	if passive {
+		p.setHealth(rawAddr, Alive)
+	}
+}
+
+// due reports whether the pingu should be probed at now. A pingu is not
+// probed while backing off, or while it pings us, see Config.PassiveLiveness,
+// or if it's in push mode.
+//
+// The caller must hold p.mu.
+func (p *Pingu) due(rawAddr string, now time.Time) bool {
+	st, ok := p.peers[rawAddr]
+	if !ok {
+		return true
+	}
+	if st.beatInterval > 0 {
+		return false
+	}
+	if p.cfg.PassiveLiveness > 0 && now.Sub(st.lastPing) < p.cfg.PassiveLiveness {
+		return false
+	}
+	return !now.Before(st.nextProbe)
+}
@@ -0,0 +1,141 @@
+package pingu_test
+
+import (
+	"net"
+	"net/netip"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/protocol-diver/pingu"
+)
+
+func TestDeadBackoff(t *testing.T) {
+	cfg := new(pingu.Config)
+	cfg.Default()
+	cfg.DeadBackoff = 50 * time.Millisecond
+	cfg.DeadBackoffMax = 100 * time.Millisecond
+	pingu1, err := pingu.NewPingu("127.0.0.1:9490", cfg)
+	if err != nil {
+		t.Fatalf("DeadBackoff NewPingu failure %v", err)
+	}
+	defer pingu1.Close()
+	pingu1.Start()
+
+	// The dead pingu counts the pings, it never answers.
+	dead, err := net.ListenUDP("udp", net.UDPAddrFromAddrPort(netip.MustParseAddrPort("127.0.0.1:9491")))
+	if err != nil {
+		t.Fatalf("DeadBackoff ListenUDP failure %v", err)
+	}
+	defer dead.Close()
+	var pings int32
+	go func() {
+		b := make([]byte, 512)
+		for {
+			if _, _, err := dead.ReadFromUDP(b); err != nil {
+				return
+			}
+			// skip the pong of the reset
+			if b[0] == 0 {
+				atomic.AddInt32(&pings, 1)
+			}
+		}
+	}()
+
+	pingu1.RegisterWithRawAddr("127.0.0.1:9491")
+	err = pingu1.StartProbing(pingu.ProbeOptions{Interval: 5 * time.Millisecond, Timeout: 5 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("DeadBackoff StartProbing failure %v", err)
+	}
+
+	time.Sleep(300 * time.Millisecond)
+	if n := atomic.LoadInt32(&pings); n == 0 || n > 10 {
+		t.Fatalf("DeadBackoff invalid ping count: %v", n)
+	}
+
+	// Any packet resets the backoff. Wait for a failed probe first, so the
+	// next one is far away.
+	n := atomic.LoadInt32(&pings)
+	for atomic.LoadInt32(&pings) == n {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	atomic.StoreInt32(&pings, 0)
+	if _, err := dead.WriteToUDP([]byte{0, 2, 123, 125}, net.UDPAddrFromAddrPort(netip.MustParseAddrPort("127.0.0.1:9490"))); err != nil {
+		t.Fatalf("DeadBackoff WriteToUDP failure %v", err)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if n := atomic.LoadInt32(&pings); n == 0 {
+		t.Fatalf("DeadBackoff invalid ping count after reset: %v", n)
+	}
+}
+
+func TestPassiveLiveness(t *testing.T) {
+	cfg := new(pingu.Config)
+	cfg.Default()
+	cfg.PassiveLiveness = 50 * time.Millisecond
+	pingu1, err := pingu.NewPingu("127.0.0.1:9492", cfg)
+	if err != nil {
+		t.Fatalf("PassiveLiveness NewPingu failure %v", err)
+	}
+	defer pingu1.Close()
+	pingu1.Start()
+
+	pingu1.RegisterWithRawAddr("127.0.0.1:9493")
+
+	// The other pingu pings, but never answers.
+	other, err := net.ListenUDP("udp", net.UDPAddrFromAddrPort(netip.MustParseAddrPort("127.0.0.1:9493")))
+	if err != nil {
+		t.Fatalf("PassiveLiveness ListenUDP failure %v", err)
+	}
+	defer other.Close()
+	var pings int32
+	go func() {
+		b := make([]byte, 512)
+		for {
+			if _, _, err := other.ReadFromUDP(b); err != nil {
+				return
+			}
+			if b[0] == 0 {
+				atomic.AddInt32(&pings, 1)
+			}
+		}
+	}()
+	stop := make(chan struct{})
+	go func() {
+		for {
+			other.WriteToUDP([]byte{0, 2, 123, 125}, net.UDPAddrFromAddrPort(netip.MustParseAddrPort("127.0.0.1:9492")))
+			select {
+			case <-stop:
+				return
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	err = pingu1.StartProbing(pingu.ProbeOptions{Interval: 10 * time.Millisecond, Timeout: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("PassiveLiveness StartProbing failure %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if n := atomic.LoadInt32(&pings); n != 0 {
+		t.Fatalf("PassiveLiveness invalid ping count: %v, want: %v", n, 0)
+	}
+	if !pingu1.IsAlive("127.0.0.1:9493") {
+		t.Fatalf("PassiveLiveness invalid result: %v", pingu1.PingTable())
+	}
+	if st, _ := pingu1.PeerState("127.0.0.1:9493"); time.Since(st.LastSeen) > 50*time.Millisecond {
+		t.Fatalf("PassiveLiveness invalid last seen: %v", st.LastSeen)
+	}
+
+	// The traffic stops, the probes resume.
+	close(stop)
+	time.Sleep(100 * time.Millisecond)
+	if n := atomic.LoadInt32(&pings); n == 0 {
+		t.Fatalf("PassiveLiveness invalid ping count: %v", n)
+	}
+	if pingu1.IsAlive("127.0.0.1:9493") {
+		t.Fatalf("PassiveLiveness invalid result: %v", pingu1.PingTable())
+	}
+}
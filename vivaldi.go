@@ -0,0 +1,214 @@
+// Copyright (c) 2022, Seungbae Yu <dbadoy4874@gmail.com>
+// All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package pingu
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+// Vivaldi places the pingus in a 2D space plus a height, the access link, so
+// that the distance between two pingus estimates their RTT. Each pingu moves
+// its own coordinate by the RTTs of its probes to the coordinates the others
+// send in their pings and pongs. See "Vivaldi: A Decentralized Network
+// Coordinate System", Dabek et al.
+const (
+	// vivaldiCE and vivaldiCC tune the error and the move of a sample.
+	vivaldiCE = 0.25
+	vivaldiCC = 0.25
+	// vivaldiMinHeight keeps the height positive, in milliseconds.
+	vivaldiMinHeight = 0.01
+	// vivaldiMaxError is the error of a pingu that never moved.
+	vivaldiMaxError = 1.5
+	// vivaldiMaxCoord bounds the components and the height, 5 minutes in
+	// milliseconds, far above any RTT.
+	vivaldiMaxCoord = 5 * 60 * 1000
+)
+
+// coordinate is a Vivaldi coordinate in milliseconds, with its relative
+// error.
+type coordinate struct {
+	x, y   float64
+	height float64
+	err    float64
+}
+
+func newCoordinate() *coordinate {
+	return &coordinate{height: vivaldiMinHeight, err: vivaldiMaxError}
+}
+
+// distance returns the estimated RTT between the coordinates, in
+// milliseconds.
+func (c *coordinate) distance(o *coordinate) float64 {
+	return math.Hypot(c.x-o.x, c.y-o.y) + c.height + o.height
+}
+
+// valid reports whether the coordinate is finite and in bounds.
+func (c *coordinate) valid() bool {
+	for _, f := range []float64{c.x, c.y, c.height, c.err} {
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return false
+		}
+	}
+	return math.Abs(c.x) <= vivaldiMaxCoord && math.Abs(c.y) <= vivaldiMaxCoord && c.height <= vivaldiMaxCoord
+}
+
+// update moves the coordinate by the RTT measured to the remote one. The
+// coordinate doesn't move if it would leave the bounds.
+func (c *coordinate) update(o *coordinate, rtt time.Duration) {
+	ms := float64(rtt) / float64(time.Millisecond)
+	if ms <= 0 {
+		return
+	}
+	next := *c
+	next.move(o, ms)
+	if next.valid() {
+		*c = next
+	}
+}
+
+// move moves the coordinate by the RTT in milliseconds.
+func (c *coordinate) move(o *coordinate, ms float64) {
+	dist := c.distance(o)
+	w := c.err / (c.err + o.err)
+	es := math.Abs(dist-ms) / ms
+	c.err = es*vivaldiCE*w + c.err*(1-vivaldiCE*w)
+	if c.err > vivaldiMaxError {
+		c.err = vivaldiMaxError
+	}
+
+	force := vivaldiCC * w * (ms - dist)
+	dx, dy := c.x-o.x, c.y-o.y
+	norm := math.Hypot(dx, dy)
+	if norm == 0 {
+		// Same place, push apart in a random direction.
+		a := rand.Float64() * 2 * math.Pi
+		dx, dy, norm = math.Cos(a), math.Sin(a), 1
+	}
+	c.x += force * dx / norm
+	c.y += force * dy / norm
+	c.height += force * (c.height + o.height) / dist
+	if c.height < vivaldiMinHeight {
+		c.height = vivaldiMinHeight
+	}
+}
+
+// encode returns the coordinate on the wire.
+func (c *coordinate) encode() []float32 {
+	return []float32{float32(c.x), float32(c.y), float32(c.height), float32(c.err)}
+}
+
+// decodeCoordinate returns the coordinate from the wire, nil if invalid or
+// out of bounds.
+func decodeCoordinate(v []float32) *coordinate {
+	if len(v) != 4 {
+		return nil
+	}
+	c := &coordinate{x: float64(v[0]), y: float64(v[1]), height: float64(v[2]), err: float64(v[3])}
+	if !c.valid() {
+		return nil
+	}
+	if c.height < vivaldiMinHeight {
+		c.height = vivaldiMinHeight
+	}
+	if c.err <= 0 || c.err > vivaldiMaxError {
+		c.err = vivaldiMaxError
+	}
+	return c
+}
+
+// stamp attaches our coordinate to the packet.
+func (p *Pingu) stamp(pkt packet) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	pkt.Header().Coord = p.coord.encode()
+}
+
+// recvCoord records the coordinate of the pingu.
+func (p *Pingu) recvCoord(rawAddr string, v []float32) {
+	c := decodeCoordinate(v)
+	if c == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if st, ok := p.peers[rawAddr]; ok && p.wl[rawAddr] {
+		st.coord = c
+	}
+}
+
+// observeCoord moves our coordinate by the RTT to the pingu.
+//
+// The caller must hold p.mu.
+func (p *Pingu) observeCoord(st *peer, rtt time.Duration) {
+	if st.coord != nil {
+		p.coord.update(st.coord, rtt)
+	}
+}
+
+// coordOf returns the coordinate of this pingu or a registered one.
+//
+// The caller must hold p.mu.
+func (p *Pingu) coordOf(rawAddr string) (*coordinate, bool) {
+	if rawAddr == p.self {
+		return p.coord, true
+	}
+	st, ok := p.peers[rawAddr]
+	if !ok || st.coord == nil {
+		return nil, false
+	}
+	return st.coord, true
+}
+
+// EstimateRTT estimates the RTT between the pingus at a and b, either one
+// being this pingu or a registered one, by their Vivaldi coordinates.
+func (p *Pingu) EstimateRTT(a, b string) (time.Duration, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	ca, ok := p.coordOf(a)
+	if !ok {
+		return 0, fmt.Errorf("unknown coordinate of %v", a)
+	}
+	cb, ok := p.coordOf(b)
+	if !ok {
+		return 0, fmt.Errorf("unknown coordinate of %v", b)
+	}
+	if a == b {
+		return 0, nil
+	}
+	return time.Duration(ca.distance(cb) * float64(time.Millisecond)), nil
+}
+
+// Nearest returns the raw addresses of the n alive pingus estimated the
+// nearest to this one, the nearest first.
+func (p *Pingu) Nearest(n int) []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var addrs []string
+	dist := make(map[string]float64)
+	for addr := range p.wl {
+		st, ok := p.peers[addr]
+		if !ok || st.health != Alive || st.coord == nil {
+			continue
+		}
+		addrs = append(addrs, addr)
+		dist[addr] = p.coord.distance(st.coord)
+	}
+	sort.Slice(addrs, func(i, j int) bool {
+		if dist[addrs[i]] != dist[addrs[j]] {
+			return dist[addrs[i]] < dist[addrs[j]]
+		}
+		return addrs[i] < addrs[j]
+	})
+	if n >= 0 && n < len(addrs) {
+		addrs = addrs[:n]
+	}
+	return addrs
+}
@@ -0,0 +1,71 @@
+package pingu
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestVivaldiConverge(t *testing.T) {
+	// 5 nodes on a line 10ms apart, each behind a 1ms access link.
+	const n = 5
+	rtt := func(i, j int) time.Duration {
+		return time.Duration(math.Abs(float64(i-j))*10+2) * time.Millisecond
+	}
+	coords := make([]*coordinate, n)
+	for i := range coords {
+		coords[i] = newCoordinate()
+	}
+	for round := 0; round < 1000; round++ {
+		for i := 0; i < n; i++ {
+			j := (i + 1 + round%(n-1)) % n
+			remote := *coords[j]
+			coords[i].update(&remote, rtt(i, j))
+		}
+	}
+	for i := 0; i < n; i++ {
+		for j := i + 1; j < n; j++ {
+			got := coords[i].distance(coords[j])
+			want := float64(rtt(i, j)) / float64(time.Millisecond)
+			if math.Abs(got-want)/want > 0.2 {
+				t.Fatalf("Vivaldi invalid estimate %d-%d got: %.2fms, want: %.2fms", i, j, got, want)
+			}
+		}
+		if coords[i].err > 0.2 {
+			t.Fatalf("Vivaldi invalid error %d got: %v", i, coords[i].err)
+		}
+	}
+}
+
+func TestDecodeCoordinate(t *testing.T) {
+	c := &coordinate{x: 1.5, y: -2.25, height: 0.5, err: 0.125}
+	if got := decodeCoordinate(c.encode()); *got != *c {
+		t.Fatalf("DecodeCoordinate got: %+v, want: %+v", got, c)
+	}
+	if decodeCoordinate([]float32{1, 2}) != nil || decodeCoordinate([]float32{1, 2, float32(math.NaN()), 1}) != nil {
+		t.Fatalf("DecodeCoordinate expected failure")
+	}
+	for _, v := range [][]float32{{1e30, 0, 1, 1}, {0, -1e30, 1, 1}, {0, 0, 1e30, 1}, {float32(math.Inf(1)), 0, 1, 1}} {
+		if c := decodeCoordinate(v); c != nil {
+			t.Fatalf("DecodeCoordinate expected failure on %v got: %+v", v, c)
+		}
+	}
+}
+
+func TestVivaldiBounds(t *testing.T) {
+	// The remote sits at the bound, an RTT far above pushes us out.
+	c := newCoordinate()
+	c.x = 1
+	remote := &coordinate{x: -vivaldiMaxCoord, height: vivaldiMinHeight, err: vivaldiMaxError}
+	want := *c
+	c.update(remote, time.Duration(math.MaxInt64))
+	if *c != want {
+		t.Fatalf("Vivaldi invalid update got: %+v, want: %+v", c, want)
+	}
+
+	// A sane RTT still moves us.
+	c.update(remote, 10*time.Millisecond)
+	if *c == want || !c.valid() {
+		t.Fatalf("Vivaldi invalid update got: %+v", c)
+	}
+}
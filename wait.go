@@ -0,0 +1,56 @@
+// Copyright (c) 2022, Seungbae Yu <dbadoy4874@gmail.com>
+// All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package pingu
+
+import (
+	"context"
+	"fmt"
+)
+
+// WaitAlive blocks until the pingu at raw is alive, or the context is done.
+func (p *Pingu) WaitAlive(ctx context.Context, raw string) error {
+	return p.WaitQuorum(ctx, []string{raw}, 1)
+}
+
+// WaitAll blocks until all the pingus are alive, or the context is done.
+func (p *Pingu) WaitAll(ctx context.Context, raws []string) error {
+	return p.WaitQuorum(ctx, raws, len(raws))
+}
+
+// WaitQuorum blocks until k of the pingus are alive, or the context is done.
+// It returns the error of the context if done first.
+//
+// The health is the one found by the probes, see StartProbing.
+func (p *Pingu) WaitQuorum(ctx context.Context, raws []string, k int) error {
+	if k < 0 || k > len(raws) {
+		return fmt.Errorf("invalid quorum: %d of %d", k, len(raws))
+	}
+	changed := p.watch()
+	defer p.unwatch(changed)
+	for {
+		if p.countAlive(raws) >= k {
+			return nil
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (p *Pingu) countAlive(raws []string) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	n := 0
+	for _, raw := range raws {
+		if st, ok := p.peers[raw]; ok && st.health == Alive {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,76 @@
+package pingu_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/protocol-diver/pingu"
+)
+
+func TestWaitQuorum(t *testing.T) {
+	addrs := []string{"127.0.0.1:10390", "127.0.0.1:10391", "127.0.0.1:10392"}
+	p, err := pingu.NewPingu(addrs[0], nil)
+	if err != nil {
+		t.Fatalf("Wait NewPingu failure %v", err)
+	}
+	defer p.Close()
+	p.Start()
+	p.RegisterWithRawAddr(addrs[1])
+	p.RegisterWithRawAddr(addrs[2])
+	if err := p.StartProbing(pingu.ProbeOptions{Interval: 10 * time.Millisecond, Timeout: 10 * time.Millisecond}); err != nil {
+		t.Fatalf("Wait StartProbing failure %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := p.WaitAlive(ctx, addrs[1]); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("WaitAlive failure got: %v, want: %v", err, context.DeadlineExceeded)
+	}
+	if err := p.WaitQuorum(context.Background(), addrs[1:], 3); err == nil {
+		t.Fatalf("WaitQuorum expected failure on invalid quorum")
+	}
+
+	done := make(chan error, 3)
+	go func() { done <- p.WaitAlive(context.Background(), addrs[1]) }()
+	go func() { done <- p.WaitQuorum(context.Background(), addrs[1:], 1) }()
+	go func() { done <- p.WaitAll(context.Background(), addrs[1:]) }()
+
+	other, err := pingu.NewPingu(addrs[1], nil)
+	if err != nil {
+		t.Fatalf("Wait NewPingu failure %v", err)
+	}
+	defer other.Close()
+	other.Start()
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatalf("Wait failure %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Wait timeout")
+		}
+	}
+	select {
+	case err := <-done:
+		t.Fatalf("WaitAll returned without all alive: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	last, err := pingu.NewPingu(addrs[2], nil)
+	if err != nil {
+		t.Fatalf("Wait NewPingu failure %v", err)
+	}
+	defer last.Close()
+	last.Start()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("WaitAll failure %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("WaitAll timeout")
+	}
+}